@@ -0,0 +1,160 @@
+package pipe
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// AckFunc is called once for a message sent with SendWithAck, err is nil
+// when the message and every message derived from it were consumed or the
+// first error returned while consuming them.
+type AckFunc func(err error)
+
+// SendWithAck sends v through s and calls fn once v and the messages derived
+// from it were consumed by every proc they reached, messages sent by a
+// consumer while consuming a message are derived from it.
+//
+// fn is called with the first error returned by a consumer callback, or
+// with the Send error if v wasn't sent, a consumer returning ErrStop
+// counts as consumed. fn is never called for messages still queued when the
+// line is canceled so they can be redelivered by the source.
+func SendWithAck(s Sender, v interface{}, fn AckFunc) error {
+	snd, ok := s.(sender)
+	if !ok {
+		return errors.New("sender doesn't support acks")
+	}
+	// the ack is held while sending so it can't fire before every branch
+	// got the message
+	a := &ackRef{pending: 1, fn: fn}
+	err := snd.send(v, append(snd.tracked(), a))
+	if err != nil {
+		a.fire(err)
+	}
+	a.release(nil)
+	return err
+}
+
+// Ack finishes a message received with Input.Recv, a non nil err nacks it.
+// Messages received by Consume and ConsumeBatch are finished when the
+// callback returns.
+func Ack(m Message, err error) {
+	as := messageAcks(m)
+	if len(as) == 0 {
+		return
+	}
+	if c := workerFromContext(m.Context()); c != nil {
+		c.untrack(as)
+	}
+	as.release(err)
+}
+
+// ackRef counts the pending messages derived from a message sent with
+// SendWithAck.
+type ackRef struct {
+	pending int64
+	fn      AckFunc
+	once    sync.Once
+}
+
+func (a *ackRef) release(err error) {
+	if err != nil && !errors.Is(err, ErrStop) {
+		a.fire(err)
+	}
+	if atomic.AddInt64(&a.pending, -1) == 0 {
+		a.fire(nil)
+	}
+}
+
+func (a *ackRef) fire(err error) {
+	a.once.Do(func() { a.fn(err) })
+}
+
+// acks are the acks a message holds, a message derived from several
+// messages holds all of their acks.
+type acks []*ackRef
+
+func (as acks) hold() {
+	for _, a := range as {
+		atomic.AddInt64(&a.pending, 1)
+	}
+}
+
+func (as acks) release(err error) {
+	for _, a := range as {
+		a.release(err)
+	}
+}
+
+func messageAcks(m Message) acks {
+	switch m := m.(type) {
+	case message:
+		return m.acks
+	case ctxMessage:
+		return messageAcks(m.Message)
+	}
+	return nil
+}
+
+type workerCtxKey struct{}
+
+// workerFromContext returns the consumer of the worker consuming with ctx.
+func workerFromContext(ctx context.Context) *consumer {
+	c, _ := ctx.Value(workerCtxKey{}).(*consumer)
+	return c
+}
+
+// track adds the acks of a message being consumed, messages sent meanwhile
+// hold them.
+func (c *consumer) track(as acks) {
+	if len(as) == 0 {
+		return
+	}
+	c.ackMu.Lock()
+	defer c.ackMu.Unlock()
+	c.acks = append(c.acks, as...)
+}
+
+// untrack removes one occurrence of each ack.
+func (c *consumer) untrack(as acks) {
+	if len(as) == 0 {
+		return
+	}
+	c.ackMu.Lock()
+	defer c.ackMu.Unlock()
+	for _, a := range as {
+		for i, ca := range c.acks {
+			if ca == a {
+				c.acks = append(c.acks[:i], c.acks[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// consume calls fn with m tracking its acks and finishes m once fn returns.
+func (c *consumer) consume(fn func() error, ms ...Message) error {
+	var as acks
+	for _, m := range ms {
+		as = append(as, messageAcks(m)...)
+	}
+	c.track(as)
+	err := fn()
+	c.untrack(as)
+	as.release(err)
+	return err
+}
+
+// tracked returns the acks held by messages sent from the worker.
+func (p sender) tracked() acks {
+	if p.worker == nil {
+		return nil
+	}
+	p.worker.ackMu.Lock()
+	defer p.worker.ackMu.Unlock()
+	if len(p.worker.acks) == 0 {
+		return nil
+	}
+	return append(acks{}, p.worker.acks...)
+}
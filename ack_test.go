@@ -0,0 +1,107 @@
+package pipe_test
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stdiopt/pipe"
+)
+
+func TestSendWithAck(t *testing.T) {
+	type result struct {
+		value     int
+		processed int
+		err       error
+	}
+	var mu sync.Mutex
+	processed := map[int]int{}
+	process := func(v int) {
+		mu.Lock()
+		defer mu.Unlock()
+		processed[v]++
+	}
+
+	results := make(chan result, 10)
+	origin := pipe.NewProc(
+		pipe.WithName("origin"),
+		pipe.WithFunc(func(s pipe.Sender) error {
+			for i := 1; i <= 3; i++ {
+				i := i
+				err := pipe.SendWithAck(s, i, func(err error) {
+					mu.Lock()
+					defer mu.Unlock()
+					results <- result{i, processed[i], err}
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	)
+	// each value reaches a sink directly and through a transform
+	transform := pipe.NewProc(
+		pipe.WithName("transform"),
+		pipe.WithWorkers(2),
+		pipe.WithSource(0, origin),
+		pipe.WithFunc(func(c pipe.Consumer, s pipe.Sender) error {
+			return c.Consume(func(v int) error {
+				return s.Send(v)
+			})
+		}),
+	)
+	pipe.NewProc(
+		pipe.WithName("sink"),
+		pipe.WithSource(0, origin, transform),
+		pipe.WithFunc(func(c pipe.Consumer) error {
+			return c.ConsumeBatch(2, 0, func(vs []int) error {
+				for _, v := range vs {
+					process(v)
+				}
+				return nil
+			})
+		}),
+	)
+
+	if err := origin.Run(); err != nil {
+		t.Fatal(err)
+	}
+	close(results)
+	got := []result{}
+	for r := range results {
+		got = append(got, r)
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i].value < got[j].value })
+	want := []result{{1, 2, nil}, {2, 2, nil}, {3, 2, nil}}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, got)
+	}
+}
+
+func TestSendWithAckNack(t *testing.T) {
+	wantErr := errors.New("write failed")
+	acked := make(chan error, 1)
+	origin := pipe.NewProc(
+		pipe.WithFunc(func(s pipe.Sender) error {
+			return pipe.SendWithAck(s, 1, func(err error) { acked <- err })
+		}),
+	)
+	pipe.NewProc(
+		pipe.WithSource(0, origin),
+		pipe.WithFunc(func(c pipe.Consumer) error {
+			return c.Consume(func(v int) error {
+				return wantErr
+			})
+		}),
+	)
+
+	if err := origin.Run(); !errors.Is(err, wantErr) {
+		t.Errorf("\nwant: %v\n got: %v\n", wantErr, err)
+	}
+	if got := <-acked; !errors.Is(got, wantErr) {
+		t.Errorf("\nwant: %v\n got: %v\n", wantErr, got)
+	}
+}
@@ -0,0 +1,221 @@
+package pipe
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by CircuitBreakerConsumer when the circuit is
+// open and the open mode is CircuitFailFast.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState int
+
+// Circuit breaker states
+const (
+	// CircuitClosed lets every message through
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects messages until the cool down ends
+	CircuitOpen
+	// CircuitHalfOpen lets a trial message through to decide if the circuit
+	// closes or opens again
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// CircuitOpenMode defines what happens to messages while the circuit is
+// open.
+type CircuitOpenMode int
+
+// Circuit open modes
+const (
+	// CircuitBlock waits until the circuit is half-open
+	CircuitBlock CircuitOpenMode = iota
+	// CircuitFailFast returns ErrCircuitOpen
+	CircuitFailFast
+	// CircuitRoute sends the message value to the consumer proc output set
+	// in CircuitBreakerConfig.Route
+	CircuitRoute
+)
+
+// CircuitBreakerConfig configures CircuitBreakerConsumer, zero values use
+// the defaults.
+type CircuitBreakerConfig struct {
+	// FailureRate is the ratio of failed messages that opens the circuit,
+	// defaults to 0.5
+	FailureRate float64
+	// MinRequests is the number of messages in a window before the failure
+	// rate is checked, defaults to 10
+	MinRequests int
+	// Window is the period failures are counted on, defaults to 10s
+	Window time.Duration
+	// CoolDown is the time the circuit stays open, defaults to 5s
+	CoolDown time.Duration
+	// OpenMode is the behaviour while the circuit is open
+	OpenMode CircuitOpenMode
+	// Route is the output index or name used by CircuitRoute
+	Route interface{}
+	// OnStateChange is called on every state transition
+	OnStateChange func(from, to CircuitState)
+}
+
+// CircuitBreakerConsumer consumer middleware that stops calling the
+// consumer while the failure rate is over the threshold, the circuit is
+// shared by every consumer using the middleware.
+func CircuitBreakerConsumer(cfg CircuitBreakerConfig) ConsumerMiddleware {
+	cb := newCircuitBreaker(cfg)
+	return func(fn ConsumerFunc) ConsumerFunc {
+		return func(m Message) error {
+			for {
+				ok, wait := cb.allow(m)
+				if ok {
+					break
+				}
+				switch cb.cfg.OpenMode {
+				case CircuitFailFast:
+					return errFatal{ErrCircuitOpen}
+				case CircuitRoute:
+					return cb.route(m)
+				}
+				select {
+				case <-m.Context().Done():
+					return m.Context().Err()
+				case <-time.After(wait):
+				}
+			}
+			err := fn(m)
+			cb.done(m, err == nil || errors.Is(err, ErrStop))
+			return err
+		}
+	}
+}
+
+type circuitBreaker struct {
+	cfg CircuitBreakerConfig
+
+	mu       sync.Mutex
+	state    CircuitState
+	opened   time.Time
+	windowAt time.Time
+	total    int
+	failures int
+	// trial is true while a half-open trial message is being consumed
+	trial bool
+}
+
+func newCircuitBreaker(cfg CircuitBreakerConfig) *circuitBreaker {
+	if cfg.FailureRate <= 0 {
+		cfg.FailureRate = 0.5
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = 10
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 10 * time.Second
+	}
+	if cfg.CoolDown <= 0 {
+		cfg.CoolDown = 5 * time.Second
+	}
+	return &circuitBreaker{cfg: cfg, windowAt: time.Now()}
+}
+
+// allow returns true if a message can be consumed, if not it returns how
+// long until the circuit might allow it.
+func (cb *circuitBreaker) allow(m Message) (bool, time.Duration) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	now := time.Now()
+	if cb.state == CircuitOpen {
+		if wait := cb.cfg.CoolDown - now.Sub(cb.opened); wait > 0 {
+			return false, wait
+		}
+		cb.setState(m, CircuitHalfOpen)
+	}
+	if cb.state == CircuitHalfOpen {
+		if cb.trial {
+			// poll until the trial finishes
+			return false, cb.cfg.CoolDown / 10
+		}
+		cb.trial = true
+		return true, 0
+	}
+	if now.Sub(cb.windowAt) >= cb.cfg.Window {
+		cb.windowAt, cb.total, cb.failures = now, 0, 0
+	}
+	return true, 0
+}
+
+// done records the result of a consumed message.
+func (cb *circuitBreaker) done(m Message, success bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == CircuitHalfOpen {
+		cb.trial = false
+		if success {
+			cb.windowAt, cb.total, cb.failures = time.Now(), 0, 0
+			cb.setState(m, CircuitClosed)
+			return
+		}
+		cb.open(m)
+		return
+	}
+	if cb.state != CircuitClosed {
+		return
+	}
+	cb.total++
+	if !success {
+		cb.failures++
+	}
+	if cb.total >= cb.cfg.MinRequests &&
+		float64(cb.failures)/float64(cb.total) >= cb.cfg.FailureRate {
+		cb.open(m)
+	}
+}
+
+func (cb *circuitBreaker) open(m Message) {
+	cb.opened = time.Now()
+	cb.setState(m, CircuitOpen)
+}
+
+// setState changes the state, m is the message being consumed.
+func (cb *circuitBreaker) setState(m Message, s CircuitState) {
+	if s == cb.state {
+		return
+	}
+	from := cb.state
+	cb.state = s
+	logger, kv := loggerFrom(m.Context())
+	logger.Log(LevelInfo, "circuit state", append(kv, "from", from.String(), "to", s.String())...)
+	if cb.cfg.OnStateChange != nil {
+		cb.cfg.OnStateChange(from, s)
+	}
+}
+
+// route sends the message value to the route output of the consuming proc.
+func (cb *circuitBreaker) route(m Message) error {
+	n := nodeFromContext(m.Context())
+	if n == nil {
+		return errFatal{ErrCircuitOpen}
+	}
+	s, ok := n.sender(cb.cfg.Route)
+	if !ok {
+		return errFatal{fmt.Errorf("%w: invalid route output %v", ErrCircuitOpen, cb.cfg.Route)}
+	}
+	return s.Send(m.Value())
+}
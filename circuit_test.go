@@ -0,0 +1,131 @@
+package pipe_test
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stdiopt/pipe"
+)
+
+func TestCircuitBreakerConsumer(t *testing.T) {
+	ints := func() *pipe.Proc {
+		return pipe.NewProc(
+			pipe.WithFunc(func(s pipe.Sender) error {
+				for i := 0; i < 5; i++ {
+					if err := s.Send(i); err != nil {
+						return err
+					}
+				}
+				return nil
+			}),
+		)
+	}
+
+	t.Run("block", func(t *testing.T) {
+		var mu sync.Mutex
+		states := []string{}
+		origin := ints()
+		calls := 0
+		res := []int{}
+		pipe.NewProc(
+			pipe.WithSource(0, origin),
+			pipe.WithConsumerMiddleware(
+				pipe.RetryConsumer(10),
+				pipe.CircuitBreakerConsumer(pipe.CircuitBreakerConfig{
+					MinRequests: 2,
+					CoolDown:    10 * time.Millisecond,
+					OnStateChange: func(from, to pipe.CircuitState) {
+						mu.Lock()
+						defer mu.Unlock()
+						states = append(states, to.String())
+					},
+				}),
+			),
+			pipe.WithFunc(func(c pipe.Consumer) error {
+				return c.Consume(func(v int) error {
+					calls++
+					if calls <= 3 {
+						return errors.New("unavailable")
+					}
+					res = append(res, v)
+					return nil
+				})
+			}),
+		)
+		if err := origin.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if want := []int{0, 1, 2, 3, 4}; !reflect.DeepEqual(res, want) {
+			t.Errorf("\nwant: %v\n got: %v\n", want, res)
+		}
+		want := []string{"open", "half-open", "open", "half-open", "closed"}
+		if !reflect.DeepEqual(states, want) {
+			t.Errorf("\nwant: %v\n got: %v\n", want, states)
+		}
+	})
+
+	t.Run("fail fast", func(t *testing.T) {
+		origin := ints()
+		pipe.NewProc(
+			pipe.WithSource(0, origin),
+			pipe.WithConsumerMiddleware(
+				pipe.RetryConsumer(10),
+				pipe.CircuitBreakerConsumer(pipe.CircuitBreakerConfig{
+					MinRequests: 2,
+					CoolDown:    time.Minute,
+					OpenMode:    pipe.CircuitFailFast,
+				}),
+			),
+			pipe.WithFunc(func(c pipe.Consumer) error {
+				return c.Consume(func(int) error {
+					return errors.New("unavailable")
+				})
+			}),
+		)
+		err := origin.Run()
+		if !errors.Is(err, pipe.ErrCircuitOpen) {
+			t.Errorf("\nwant: %v\n got: %v\n", pipe.ErrCircuitOpen, err)
+		}
+	})
+
+	t.Run("route", func(t *testing.T) {
+		origin := ints()
+		p := pipe.NewProc(
+			pipe.WithOutputs("ok", "errors"),
+			pipe.WithSource(0, origin),
+			pipe.WithConsumerMiddleware(
+				pipe.RetryConsumer(2),
+				pipe.CircuitBreakerConsumer(pipe.CircuitBreakerConfig{
+					MinRequests: 2,
+					CoolDown:    time.Minute,
+					OpenMode:    pipe.CircuitRoute,
+					Route:       "errors",
+				}),
+			),
+			pipe.WithFunc(func(c pipe.Consumer, _, _ pipe.Sender) error {
+				return c.Consume(func(int) error {
+					return errors.New("unavailable")
+				})
+			}),
+		)
+		res := []int{}
+		pipe.NewProc(
+			pipe.WithNamedSource("errors", p),
+			pipe.WithFunc(func(c pipe.Consumer) error {
+				return c.Consume(func(v int) error {
+					res = append(res, v)
+					return nil
+				})
+			}),
+		)
+		if err := origin.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if want := []int{0, 1, 2, 3, 4}; !reflect.DeepEqual(res, want) {
+			t.Errorf("\nwant: %v\n got: %v\n", want, res)
+		}
+	})
+}
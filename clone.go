@@ -0,0 +1,82 @@
+package pipe
+
+// Clone returns a deep copy of the procs linked from root, including the
+// links, options and composite procs, so the same topology can run several
+// times with independent graphs.
+//
+// Proc funcs and middlewares are shared by the copies and must be safe for
+// concurrent use, rate limits from WithRateLimit are not shared. Funcs that
+// compare message origins with procs captured when built, like join.New or
+// op.Zip, must compare them with Is.
+//
+// Running the same graph concurrently is also safe as lines keep their
+// runtime state apart from the procs, but the runs share the rate limits.
+func Clone(root *Proc) *Proc {
+	clones := map[*Proc]*Proc{}
+	ret := cloneProc(root, clones)
+	for p, c := range clones {
+		if p.parent != nil {
+			c.parent = clones[p.parent]
+		}
+	}
+	return ret
+}
+
+// Is returns true if p is q or a copy of q made by Clone.
+func (p *Proc) Is(q *Proc) bool {
+	for ; p != nil; p = p.cloneOf {
+		if p == q {
+			return true
+		}
+	}
+	return false
+}
+
+func cloneProc(p *Proc, clones map[*Proc]*Proc) *Proc {
+	if c, ok := clones[p]; ok {
+		return c
+	}
+	p.mu.Lock()
+	c := &Proc{
+		name:               p.name,
+		nworkers:           p.nworkers,
+		bufsize:            p.bufsize,
+		fn:                 p.fn,
+		consumerMiddleware: p.consumerMiddleware,
+		middlewares:        p.middlewares,
+		logger:             p.logger,
+		outputs:            append([]string(nil), p.outputs...),
+		cloneOf:            p,
+	}
+	if p.limiter != nil {
+		c.limiter = newRateLimiter(p.limiter.rate, int(p.limiter.burst))
+	}
+	targets := map[int]group{}
+	for k, g := range p.targets {
+		targets[k] = append(group{}, g...)
+	}
+	p.mu.Unlock()
+	clones[p] = c
+
+	if len(targets) > 0 {
+		c.targets = map[int]group{}
+	}
+	for k, g := range targets {
+		for _, t := range g {
+			tc := cloneProc(t, clones)
+			c.targets[k] = append(c.targets[k], tc)
+			tc.addSource(c)
+		}
+	}
+	if p.sub != nil {
+		sub := &subgraph{}
+		for _, in := range p.sub.inputs {
+			sub.inputs = append(sub.inputs, cloneProc(in, clones))
+		}
+		for _, pt := range p.sub.ports {
+			sub.ports = append(sub.ports, port{cloneProc(pt.proc, clones), pt.output})
+		}
+		c.sub = sub
+	}
+	return c
+}
@@ -0,0 +1,70 @@
+package pipe_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stdiopt/pipe"
+)
+
+func TestClone(t *testing.T) {
+	var received int64
+	origin := pipe.NewProc(
+		pipe.WithName("origin"),
+		pipe.WithFunc(func(s pipe.Sender) error {
+			for i := 0; i < 100; i++ {
+				if err := s.Send(i); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	)
+	pipe.NewProc(
+		pipe.WithName("sink"),
+		pipe.WithWorkers(2),
+		pipe.WithBuffer(4),
+		pipe.WithSource(0, origin),
+		pipe.WithFunc(func(c pipe.Consumer) error {
+			return c.Consume(func(interface{}) error {
+				atomic.AddInt64(&received, 1)
+				return nil
+			})
+		}),
+	)
+
+	clone := pipe.Clone(origin)
+	if want, got := pipe.DumpDOT(origin), pipe.DumpDOT(clone); want != got {
+		t.Errorf("\nwant: %v\n got: %v\n", want, got)
+	}
+
+	// links added to the clone don't change the original graph
+	want := pipe.DumpDOT(origin)
+	pipe.NewProc(
+		pipe.WithSource(0, clone),
+		pipe.WithFunc(func(c pipe.Consumer) error {
+			return c.Consume(func(interface{}) error { return nil })
+		}),
+	)
+	if got := pipe.DumpDOT(origin); want != got {
+		t.Errorf("\nwant: %v\n got: %v\n", want, got)
+	}
+
+	// original and clone run concurrently, the original twice
+	wg := sync.WaitGroup{}
+	for _, p := range []*pipe.Proc{origin, origin, clone} {
+		p := p
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := p.Run(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if want, got := int64(300), atomic.LoadInt64(&received); want != got {
+		t.Errorf("\nwant: %v\n got: %v\n", want, got)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/stdiopt/pipe"
+	"github.com/stdiopt/pipe/config"
+	"github.com/stdiopt/pipe/op"
+	"github.com/stdiopt/pipe/sink"
+	"github.com/stdiopt/pipe/source"
+)
+
+// Formats supported by the builtin readers and writers.
+const (
+	formatLines = "lines"
+	formatJSONL = "jsonl"
+)
+
+type ioParams struct {
+	Path   string `json:"path"`
+	Format string `json:"format"`
+}
+
+func decodeIOParams(params config.Params, needPath bool) (ioParams, error) {
+	p := ioParams{}
+	if err := params.Decode(&p); err != nil {
+		return p, err
+	}
+	switch p.Format {
+	case "":
+		p.Format = formatLines
+	case formatLines, formatJSONL:
+	default:
+		return p, fmt.Errorf("unknown format %q", p.Format)
+	}
+	if needPath && p.Path == "" {
+		return p, fmt.Errorf("missing path")
+	}
+	return p, nil
+}
+
+// newRegistry returns a registry with the builtin types, stdin and stdout
+// are used by the respective types.
+func newRegistry(stdin io.Reader, stdout io.Writer) *config.Registry {
+	r := config.NewRegistry()
+	r.Register("stdin", func(params config.Params, opts ...pipe.ProcFunc) (*pipe.Proc, error) {
+		p, err := decodeIOParams(params, false)
+		if err != nil {
+			return nil, err
+		}
+		return readerProc(func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(stdin), nil
+		}, p.Format, opts), nil
+	})
+	r.Register("stdout", func(params config.Params, opts ...pipe.ProcFunc) (*pipe.Proc, error) {
+		p, err := decodeIOParams(params, false)
+		if err != nil {
+			return nil, err
+		}
+		return sink.ToWriter(stdout, formatter(p.Format), opts...), nil
+	})
+	r.Register("file-reader", func(params config.Params, opts ...pipe.ProcFunc) (*pipe.Proc, error) {
+		p, err := decodeIOParams(params, true)
+		if err != nil {
+			return nil, err
+		}
+		return readerProc(func() (io.ReadCloser, error) {
+			return os.Open(p.Path)
+		}, p.Format, opts), nil
+	})
+	r.Register("file-writer", func(params config.Params, opts ...pipe.ProcFunc) (*pipe.Proc, error) {
+		p, err := decodeIOParams(params, true)
+		if err != nil {
+			return nil, err
+		}
+		name := func(int) string { return p.Path }
+		return sink.ToFiles(name, sink.Rotation{}, formatter(p.Format), opts...), nil
+	})
+	r.Register("tee", func(params config.Params, opts ...pipe.ProcFunc) (*pipe.Proc, error) {
+		n, err := decodeCount(params)
+		if err != nil {
+			return nil, err
+		}
+		return op.Tee(n, opts...), nil
+	})
+	r.Register("take", func(params config.Params, opts ...pipe.ProcFunc) (*pipe.Proc, error) {
+		n, err := decodeCount(params)
+		if err != nil {
+			return nil, err
+		}
+		return op.Take(n, opts...), nil
+	})
+	r.Register("debounce", func(params config.Params, opts ...pipe.ProcFunc) (*pipe.Proc, error) {
+		d, err := decodeInterval(params)
+		if err != nil {
+			return nil, err
+		}
+		return op.Debounce(d, opts...), nil
+	})
+	r.Register("sample", func(params config.Params, opts ...pipe.ProcFunc) (*pipe.Proc, error) {
+		d, err := decodeInterval(params)
+		if err != nil {
+			return nil, err
+		}
+		return op.Sample(d, opts...), nil
+	})
+	return r
+}
+
+// decodeCount decodes the count param of tee and take, it's not named n as
+// YAML reads a n key as false.
+func decodeCount(params config.Params) (int, error) {
+	p := struct {
+		Count int `json:"count"`
+	}{}
+	if err := params.Decode(&p); err != nil {
+		return 0, err
+	}
+	if p.Count <= 0 {
+		return 0, fmt.Errorf("count must be greater than 0")
+	}
+	return p.Count, nil
+}
+
+// decodeInterval decodes the interval param of debounce and sample as a
+// time.Duration string.
+func decodeInterval(params config.Params) (time.Duration, error) {
+	p := struct {
+		Interval string `json:"interval"`
+	}{}
+	if err := params.Decode(&p); err != nil {
+		return 0, err
+	}
+	d, err := time.ParseDuration(p.Interval)
+	if err != nil {
+		return 0, fmt.Errorf("invalid interval: %w", err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("interval must be greater than 0")
+	}
+	return d, nil
+}
+
+// readerProc returns a proc that sends lines or decoded JSON values read
+// from the reader returned by open, the reader is only opened when the
+// proc runs.
+func readerProc(open func() (io.ReadCloser, error), format string, opts []pipe.ProcFunc) *pipe.Proc {
+	if format != formatJSONL {
+		return source.Open(open, bufio.ScanLines, opts...)
+	}
+	fn := func(c pipe.Consumer, out pipe.Sender) error {
+		r, err := open()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		dec := json.NewDecoder(r)
+		for c.Context().Err() == nil {
+			var v interface{}
+			if err := dec.Decode(&v); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if err := out.Send(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return pipe.NewProc(append([]pipe.ProcFunc{pipe.WithFunc(fn)}, opts...)...)
+}
+
+func formatter(format string) sink.Formatter {
+	if format == formatJSONL {
+		return sink.FormatJSON
+	}
+	return sink.FormatLine
+}
@@ -0,0 +1,190 @@
+// Command pipectl validates, draws and runs declarative pipeline files.
+//
+// Usage:
+//
+//	pipectl validate <file>
+//	pipectl graph [-format dot|mermaid|json] <file>
+//	pipectl run [-debug addr] <file>
+//	pipectl stats [-json] <addr>
+//
+// Pipeline files are described in the config package, the builtin types
+// are:
+//
+//	stdin        reads from stdin, params: format
+//	stdout       writes to stdout, params: format
+//	file-reader  reads a file, params: path, format
+//	file-writer  writes a file, params: path, format
+//	tee          sends every value to count outputs, params: count
+//	take         sends the first count values, params: count
+//	debounce     sends a value after interval without newer ones, params: interval
+//	sample       sends the latest value every interval, params: interval
+//
+// format is either "lines" (default) or "jsonl" for JSON lines and interval
+// is a duration such as "500ms". Transforms that need Go funcs, like map or
+// filter, can't be built from files, they're registered by programs using
+// the config package.
+//
+// run -debug serves the pipe/debug handler on addr so a running pipeline
+// can be inspected with pipectl stats.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/stdiopt/pipe"
+	"github.com/stdiopt/pipe/config"
+	"github.com/stdiopt/pipe/debug"
+)
+
+const usage = `usage:
+	pipectl validate <file>
+	pipectl graph [-format dot|mermaid|json] <file>
+	pipectl run [-debug addr] <file>
+	pipectl stats [-json] <addr>
+`
+
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		cancel()
+	}()
+
+	err := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	if errors.Is(err, errUsage) {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "pipectl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	cmd, args := args[0], args[1:]
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	switch cmd {
+	case "validate":
+		if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+			return errUsage
+		}
+		if _, err := load(fs.Arg(0), stdin, stdout); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "%s: ok\n", fs.Arg(0))
+		return nil
+	case "graph":
+		format := fs.String("format", "dot", "graph format: dot, mermaid or json")
+		if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+			return errUsage
+		}
+		dump, ok := map[string]func(*pipe.Proc) string{
+			"dot":     pipe.DumpDOT,
+			"mermaid": pipe.DumpMermaid,
+			"json":    pipe.DumpJSON,
+		}[*format]
+		if !ok {
+			return fmt.Errorf("unknown format %q", *format)
+		}
+		pl, err := load(fs.Arg(0), stdin, stdout)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, strings.TrimSpace(dump(pl.Root)))
+		return nil
+	case "run":
+		addr := fs.String("debug", "", "serve the debug handler on addr")
+		if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+			return errUsage
+		}
+		pl, err := load(fs.Arg(0), stdin, stdout)
+		if err != nil {
+			return err
+		}
+		return runPipeline(ctx, pl, *addr, stderr)
+	case "stats":
+		asJSON := fs.Bool("json", false, "print the stats as JSON")
+		if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+			return errUsage
+		}
+		path := "/"
+		if *asJSON {
+			path = "/stats"
+		}
+		return stats(ctx, fs.Arg(0), path, stdout)
+	}
+	return errUsage
+}
+
+func load(path string, stdin io.Reader, stdout io.Writer) (*config.Pipeline, error) {
+	def, err := config.ParseFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return newRegistry(stdin, stdout).Build(def)
+}
+
+func runPipeline(ctx context.Context, pl *config.Pipeline, addr string, stderr io.Writer) error {
+	if addr == "" {
+		return pl.Root.RunWithContext(ctx)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	l := pl.Root.Start(ctx, pipe.WithSampling(100, 10))
+	srv := &http.Server{Handler: debug.Handler(l)}
+	go srv.Serve(ln)
+	fmt.Fprintf(stderr, "debug handler listening on http://%s\n", ln.Addr())
+
+	err = l.Wait()
+	if cerr := srv.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func stats(ctx context.Context, addr, path string, stdout io.Writer) error {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(addr, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+	_, err = stdout.Write(body)
+	return err
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stdiopt/pipe"
+	"github.com/stdiopt/pipe/debug"
+)
+
+func writeFile(t *testing.T, data string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "pipectl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "pipeline.yaml")
+	if err := ioutil.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRun(t *testing.T) {
+	pipeline := writeFile(t, `
+procs:
+  - {name: in, type: stdin, params: {format: jsonl}}
+  - {name: out, type: stdout, params: {format: jsonl}, sources: [{proc: in}]}
+`)
+	invalid := writeFile(t, `
+procs:
+  - {name: in, type: stdin, outputs: [lines]}
+  - {name: out, type: stdout, sources: [{proc: in, output: rows}]}
+`)
+	transforms := writeFile(t, `
+procs:
+  - {name: in, type: stdin}
+  - {name: first, type: take, params: {count: 2}, sources: [{proc: in}]}
+  - {name: copy, type: tee, params: {count: 2}, sources: [{proc: first}]}
+  - {name: out, type: stdout, sources: [{proc: copy, output: 0}, {proc: copy, output: 1}]}
+`)
+	invalidIndex := writeFile(t, `
+procs:
+  - {name: in, type: stdin}
+  - {name: out, type: stdout, sources: [{proc: in, output: 3}]}
+`)
+
+	tests := []struct {
+		name  string
+		args  []string
+		stdin string
+		want  string
+		err   string
+	}{
+		{
+			name:  "run",
+			args:  []string{"run", pipeline},
+			stdin: `{"a":1} {"b":[2]}` + "\n",
+			want:  "{\"a\":1}\n{\"b\":[2]}\n",
+		},
+		{
+			name:  "run transforms",
+			args:  []string{"run", transforms},
+			stdin: "a\nb\nc\n",
+			want:  "a\na\nb\nb\n",
+		},
+		{
+			name: "validate",
+			args: []string{"validate", pipeline},
+			want: pipeline + ": ok\n",
+		},
+		{
+			name: "validate unknown output",
+			args: []string{"validate", invalid},
+			err:  `proc "out": source "in": unknown output "rows"`,
+		},
+		{
+			name: "validate unknown output index",
+			args: []string{"validate", invalidIndex},
+			err:  `proc "out": source "in": unknown output 3`,
+		},
+		{
+			name: "graph",
+			args: []string{"graph", "-format", "mermaid", pipeline},
+			want: "graph LR\n\tn0((\"in\"))\n\tn1((\"out\"))\n\tn0 --> n1\n",
+		},
+		{
+			name: "graph unknown format",
+			args: []string{"graph", "-format", "svg", pipeline},
+			err:  `unknown format "svg"`,
+		},
+		{
+			name: "usage",
+			args: []string{"draw", pipeline},
+			err:  errUsage.Error(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			err := run(context.Background(), tt.args, strings.NewReader(tt.stdin), stdout, ioutil.Discard)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("\nwant: %v\n got: %v\n", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, got := tt.want, stdout.String(); want != got {
+				t.Errorf("\nwant: %q\n got: %q\n", want, got)
+			}
+		})
+	}
+}
+
+func TestStats(t *testing.T) {
+	origin := pipe.NewProc(
+		pipe.WithName("origin"),
+		pipe.WithFunc(func(s pipe.Sender) error { return s.Send(1) }),
+	)
+	pipe.NewProc(
+		pipe.WithName("sink"),
+		pipe.WithSource(0, origin),
+		pipe.WithFunc(func(c pipe.Consumer) error {
+			return c.Consume(func(interface{}) error { return nil })
+		}),
+	)
+	l := origin.Start(context.Background())
+	if err := l.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(debug.Handler(l))
+	defer srv.Close()
+
+	stdout := &bytes.Buffer{}
+	if err := run(context.Background(), []string{"stats", "-json", srv.URL}, nil, stdout, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := `"id": "sink"`, stdout.String(); !strings.Contains(got, want) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, got)
+	}
+}
@@ -0,0 +1,276 @@
+// Package config builds pipelines from YAML or JSON documents.
+//
+// Proc implementations are registered by name with a Factory and a document
+// describes the procs and their links:
+//
+//	procs:
+//	  - name: reader
+//	    type: csv-reader
+//	    params: {path: input.csv}
+//	  - name: split
+//	    type: partition
+//	    workers: 4
+//	    outputs: [valid, invalid]
+//	    sources: [{proc: reader}]
+//	  - name: writer
+//	    type: json-writer
+//	    buffer: 10
+//	    sources: [{proc: split, output: valid}]
+//
+// A link output can be an output name or index, it defaults to 0.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Definition describes a pipeline.
+type Definition struct {
+	Procs []ProcDef `json:"procs"`
+}
+
+// ProcDef describes a proc, Type is the name of a registered Factory.
+type ProcDef struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Workers int      `json:"workers,omitempty"`
+	Buffer  int      `json:"buffer,omitempty"`
+	Outputs []string `json:"outputs,omitempty"`
+	Sources []Link   `json:"sources,omitempty"`
+	Params  Params   `json:"params,omitempty"`
+}
+
+// Link describes a source of a proc, Output is an output name or index.
+type Link struct {
+	Proc   string      `json:"proc"`
+	Output interface{} `json:"output,omitempty"`
+}
+
+// output returns the link output as an int index or a string name.
+func (l Link) output() (interface{}, error) {
+	switch v := l.Output.(type) {
+	case nil:
+		return 0, nil
+	case string:
+		return v, nil
+	case float64:
+		if v < 0 || v != float64(int(v)) {
+			return nil, fmt.Errorf("invalid output %v", v)
+		}
+		return int(v), nil
+	case int:
+		return v, nil
+	}
+	return nil, fmt.Errorf("invalid output %v", l.Output)
+}
+
+// Params are the factory specific proc parameters.
+type Params map[string]interface{}
+
+// Decode decodes the params into v as if they were a JSON object.
+func (p Params) Decode(v interface{}) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// Parse parses a YAML or JSON document, unknown fields are an error.
+func Parse(data []byte) (*Definition, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	// YAML is converted to JSON so both formats share the decoding
+	b, err := json.Marshal(jsonValue(doc))
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	def := &Definition{}
+	if err := dec.Decode(def); err != nil {
+		return nil, err
+	}
+	return def, nil
+}
+
+// ParseFile parses a YAML or JSON document from a file.
+func ParseFile(path string) (*Definition, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	def, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return def, nil
+}
+
+// jsonValue converts YAML maps with interface{} keys to string keys.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, vv := range v {
+			m[fmt.Sprint(k)] = jsonValue(vv)
+		}
+		return m
+	case []interface{}:
+		for i, vv := range v {
+			v[i] = jsonValue(vv)
+		}
+	}
+	return v
+}
+
+// Validate checks the definition structure, the proc names, the links and
+// cycles, registered types and declared outputs are checked by Build.
+func (d *Definition) Validate() error {
+	errs := []string{}
+	procs := map[string]*ProcDef{}
+	for i := range d.Procs {
+		pd := &d.Procs[i]
+		switch {
+		case pd.Name == "":
+			errs = append(errs, fmt.Sprintf("proc #%d: missing name", i))
+			continue
+		case procs[pd.Name] != nil:
+			errs = append(errs, fmt.Sprintf("proc %q: duplicate name", pd.Name))
+			continue
+		}
+		procs[pd.Name] = pd
+		if pd.Type == "" {
+			errs = append(errs, fmt.Sprintf("proc %q: missing type", pd.Name))
+		}
+	}
+	for _, pd := range d.Procs {
+		for _, l := range pd.Sources {
+			src, ok := procs[l.Proc]
+			if !ok {
+				errs = append(errs, fmt.Sprintf("proc %q: unknown source %q", pd.Name, l.Proc))
+				continue
+			}
+			out, err := l.output()
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("proc %q: source %q: %v", pd.Name, l.Proc, err))
+				continue
+			}
+			// outputs declared by factories are checked by Build
+			if len(src.Outputs) == 0 {
+				continue
+			}
+			if err := checkOutput(src.Outputs, out); err != nil {
+				errs = append(errs, fmt.Sprintf("proc %q: source %q: %v", pd.Name, l.Proc, err))
+			}
+		}
+	}
+	if len(errs) == 0 {
+		if cycle := d.cycle(); cycle != nil {
+			errs = append(errs, fmt.Sprintf("cycle: %s", strings.Join(cycle, " -> ")))
+		}
+	}
+	if len(errs) == 0 && len(d.Procs) > 0 {
+		if roots := d.roots(); len(roots) != 1 {
+			errs = append(errs, fmt.Sprintf("pipeline must have exactly 1 proc without sources, got %d: %v", len(roots), roots))
+		}
+	}
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// checkOutput checks if out is a declared output, indexes are only checked
+// if outputs are declared.
+func checkOutput(outputs []string, out interface{}) error {
+	switch v := out.(type) {
+	case string:
+		for _, o := range outputs {
+			if o == v {
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown output %q", v)
+	case int:
+		if len(outputs) > 0 && v >= len(outputs) {
+			return fmt.Errorf("unknown output %d", v)
+		}
+	}
+	return nil
+}
+
+// cycle returns the proc names of a cycle if any.
+func (d *Definition) cycle() []string {
+	targets := map[string][]string{}
+	for _, pd := range d.Procs {
+		for _, l := range pd.Sources {
+			targets[l.Proc] = append(targets[l.Proc], pd.Name)
+		}
+	}
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[string]int{}
+	path := []string{}
+	var walk func(name string) []string
+	walk = func(name string) []string {
+		switch state[name] {
+		case visiting:
+			for i, n := range path {
+				if n == name {
+					return append(append([]string{}, path[i:]...), name)
+				}
+			}
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, t := range targets[name] {
+			if c := walk(t); c != nil {
+				return c
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+	for _, pd := range d.Procs {
+		if c := walk(pd.Name); c != nil {
+			return c
+		}
+	}
+	return nil
+}
+
+// roots returns the names of procs without sources.
+func (d *Definition) roots() []string {
+	ret := []string{}
+	for _, pd := range d.Procs {
+		if len(pd.Sources) == 0 {
+			ret = append(ret, pd.Name)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// ValidationError lists every problem found in a definition.
+type ValidationError struct {
+	Errors []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid pipeline: " + strings.Join(e.Errors, "; ")
+}
@@ -0,0 +1,165 @@
+package config_test
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stdiopt/pipe"
+	"github.com/stdiopt/pipe/config"
+	"github.com/stdiopt/pipe/op"
+	"github.com/stdiopt/pipe/sink"
+	"github.com/stdiopt/pipe/source"
+)
+
+func newRegistry(res *[]int) *config.Registry {
+	r := config.NewRegistry()
+	r.Register("numbers", func(params config.Params, opts ...pipe.ProcFunc) (*pipe.Proc, error) {
+		var p struct{ Count int }
+		if err := params.Decode(&p); err != nil {
+			return nil, err
+		}
+		values := []int{}
+		for i := 1; i <= p.Count; i++ {
+			values = append(values, i)
+		}
+		return source.Slice(values, opts...), nil
+	})
+	r.Register("even", func(params config.Params, opts ...pipe.ProcFunc) (*pipe.Proc, error) {
+		return op.Partition(func(v int) (bool, error) { return v%2 == 0, nil }, opts...), nil
+	})
+	r.Register("collect", func(params config.Params, opts ...pipe.ProcFunc) (*pipe.Proc, error) {
+		return sink.ToSlice(res, opts...), nil
+	})
+	return r
+}
+
+func TestLoad(t *testing.T) {
+	docs := map[string]string{
+		"yaml": `
+procs:
+  - name: numbers
+    type: numbers
+    params: {count: 6}
+  - name: split
+    type: even
+    workers: 2
+    sources: [{proc: numbers}]
+  - name: collect
+    type: collect
+    buffer: 4
+    sources: [{proc: split, output: match}]
+`,
+		"json": `{"procs": [
+	{"name": "numbers", "type": "numbers", "params": {"count": 6}},
+	{"name": "split", "type": "even", "workers": 2, "sources": [{"proc": "numbers"}]},
+	{"name": "collect", "type": "collect", "buffer": 4, "sources": [{"proc": "split", "output": 0}]}
+]}`,
+	}
+	for name, doc := range docs {
+		t.Run(name, func(t *testing.T) {
+			res := []int{}
+			pl, err := newRegistry(&res).Load([]byte(doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, got := "<numbers>", pl.Root.String(); want != got {
+				t.Errorf("\nwant: %v\n got: %v\n", want, got)
+			}
+			if err := pl.Run(); err != nil {
+				t.Fatal(err)
+			}
+			sort.Ints(res)
+			if want, got := []int{2, 4, 6}, res; !reflect.DeepEqual(want, got) {
+				t.Errorf("\nwant: %v\n got: %v\n", want, got)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{
+			name: "unknown field",
+			doc:  `procs: [{name: a, type: numbers, worker: 2}]`,
+			want: `unknown field "worker"`,
+		},
+		{
+			name: "unknown type",
+			doc:  `procs: [{name: a, type: csv}]`,
+			want: `proc "a": unknown type "csv"`,
+		},
+		{
+			name: "unknown source",
+			doc:  `procs: [{name: a, type: numbers}, {name: b, type: collect, sources: [{proc: c}]}]`,
+			want: `proc "b": unknown source "c"`,
+		},
+		{
+			name: "unknown declared output",
+			doc: `procs: [
+				{name: a, type: numbers, outputs: [out]},
+				{name: b, type: collect, sources: [{proc: a, output: other}]},
+			]`,
+			want: `proc "b": source "a": unknown output "other"`,
+		},
+		{
+			name: "unknown factory output",
+			doc: `procs: [
+				{name: a, type: numbers},
+				{name: b, type: even, sources: [{proc: a}]},
+				{name: c, type: collect, sources: [{proc: b, output: odd}]},
+			]`,
+			want: `proc "c": source "b": unknown output "odd"`,
+		},
+		{
+			name: "unknown output index",
+			doc: `procs: [
+				{name: a, type: numbers},
+				{name: b, type: collect, sources: [{proc: a, output: 3}]},
+			]`,
+			want: `proc "b": source "a": unknown output 3`,
+		},
+		{
+			name: "declared output without sender",
+			doc: `procs: [
+				{name: a, type: numbers, outputs: [out, extra]},
+				{name: b, type: collect, sources: [{proc: a, output: extra}]},
+			]`,
+			want: `proc "b": source "a": unknown output "extra"`,
+		},
+		{
+			name: "cycle",
+			doc: `procs: [
+				{name: a, type: numbers},
+				{name: b, type: even, sources: [{proc: a}, {proc: c}]},
+				{name: c, type: even, sources: [{proc: b}]},
+			]`,
+			want: `cycle: b -> c -> b`,
+		},
+		{
+			name: "multiple roots",
+			doc:  `procs: [{name: a, type: numbers}, {name: b, type: numbers}]`,
+			want: `exactly 1 proc without sources, got 2: [a b]`,
+		},
+		{
+			name: "factory error",
+			doc:  `procs: [{name: a, type: numbers, params: {count: x}}]`,
+			want: `proc "a": json: cannot unmarshal string`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := []int{}
+			_, err := newRegistry(&res).Load([]byte(tt.doc))
+			if got := fmt.Sprint(err); !strings.Contains(got, tt.want) {
+				t.Errorf("\nwant: %v\n got: %v\n", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/stdiopt/pipe"
+)
+
+// Factory creates a proc from the definition params, opts carry the name,
+// workers, buffer and outputs from the definition and must be passed to the
+// created proc after any default option.
+type Factory func(params Params, opts ...pipe.ProcFunc) (*pipe.Proc, error)
+
+// Registry holds factories by type name.
+type Registry struct {
+	mu        sync.RWMutex
+	factories map[string]Factory
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{factories: map[string]Factory{}}
+}
+
+// DefaultRegistry is used by the package level Register and Load.
+var DefaultRegistry = NewRegistry()
+
+// Register registers a factory in the default registry.
+func Register(name string, f Factory) { DefaultRegistry.Register(name, f) }
+
+// Load parses and builds a pipeline with the default registry.
+func Load(data []byte) (*Pipeline, error) { return DefaultRegistry.Load(data) }
+
+// Register makes a factory available by name, it panics if name is already
+// registered.
+func (r *Registry) Register(name string, f Factory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f == nil {
+		panic("config: Register factory is nil")
+	}
+	if _, dup := r.factories[name]; dup {
+		panic("config: Register called twice for " + name)
+	}
+	r.factories[name] = f
+}
+
+// Types returns the registered type names sorted.
+func (r *Registry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ret := make([]string, 0, len(r.factories))
+	for k := range r.factories {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func (r *Registry) factory(name string) (Factory, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	f, ok := r.factories[name]
+	return f, ok
+}
+
+// Pipeline is a built pipeline, Root is the proc without sources that
+// starts the line.
+type Pipeline struct {
+	Root  *pipe.Proc
+	Procs map[string]*pipe.Proc
+}
+
+// Run runs the pipeline from Root.
+func (p *Pipeline) Run(opts ...pipe.RunOption) error {
+	return p.Root.Run(opts...)
+}
+
+// Load parses and builds a pipeline.
+func (r *Registry) Load(data []byte) (*Pipeline, error) {
+	def, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return r.Build(def)
+}
+
+// Build validates the definition and creates its procs and links.
+func (r *Registry) Build(def *Definition) (*Pipeline, error) {
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+	errs := []string{}
+	for _, pd := range def.Procs {
+		if _, ok := r.factory(pd.Type); !ok {
+			errs = append(errs, fmt.Sprintf("proc %q: unknown type %q", pd.Name, pd.Type))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, &ValidationError{Errors: errs}
+	}
+
+	pl := &Pipeline{Procs: map[string]*pipe.Proc{}}
+	for _, pd := range def.Procs {
+		f, _ := r.factory(pd.Type)
+		opts := []pipe.ProcFunc{pipe.WithName(pd.Name)}
+		if pd.Workers > 0 {
+			opts = append(opts, pipe.WithWorkers(pd.Workers))
+		}
+		if pd.Buffer > 0 {
+			opts = append(opts, pipe.WithBuffer(pd.Buffer))
+		}
+		if len(pd.Outputs) > 0 {
+			opts = append(opts, pipe.WithOutputs(pd.Outputs...))
+		}
+		p, err := f(pd.Params, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("proc %q: %w", pd.Name, err)
+		}
+		pl.Procs[pd.Name] = p
+		if len(pd.Sources) == 0 {
+			pl.Root = p
+		}
+	}
+
+	// outputs declared by factories are only known after creating the procs
+	for _, pd := range def.Procs {
+		p := pl.Procs[pd.Name]
+		for _, l := range pd.Sources {
+			src := pl.Procs[l.Proc]
+			out, _ := l.output()
+			if err := checkOutput(src.Outputs(), out); err != nil {
+				errs = append(errs, fmt.Sprintf("proc %q: source %q: %v", pd.Name, l.Proc, err))
+				continue
+			}
+			if err := checkSender(src, out); err != nil {
+				errs = append(errs, fmt.Sprintf("proc %q: source %q: %v", pd.Name, l.Proc, err))
+				continue
+			}
+			switch out := out.(type) {
+			case string:
+				pipe.WithNamedSource(out, src)(p)
+			case int:
+				pipe.WithSource(out, src)(p)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, &ValidationError{Errors: errs}
+	}
+	return pl, nil
+}
+
+// checkSender checks if out is an output of the proc func, names declared
+// with WithOutputs might exceed the func outputs.
+func checkSender(p *pipe.Proc, out interface{}) error {
+	i, ok := out.(int)
+	if !ok {
+		i = -1
+		for j, name := range p.Outputs() {
+			if name == out {
+				i = j
+			}
+		}
+	}
+	if i >= p.NumOutputs() {
+		if name, ok := out.(string); ok {
+			return fmt.Errorf("unknown output %q", name)
+		}
+		return fmt.Errorf("unknown output %d", i)
+	}
+	return nil
+}
@@ -2,8 +2,12 @@ package pipe
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // ConsumerFunc type of base function for the consumer
@@ -17,36 +21,405 @@ type Consumer interface {
 	// Consume will call the fn for every value received,
 	// fn must be a func with a signature like `func(T)error` where T is any type
 	Consume(fn interface{}) error
+
+	// ConsumeBatch will call fn with batches of at most size values, fn
+	// must be a func with a signature like `func([]T)error` where T is any
+	// type, the consumer middleware wraps each fn call with a message
+	// holding the batch values as a []interface{}
+	ConsumeBatch(size int, maxWait time.Duration, fn interface{}) error
+
+	// Inputs returns the consumer inputs, one per linked source output, to
+	// receive messages from a specific source
+	Inputs() []Input
+}
+
+// Input is a link from a source proc output to a consumer, messages
+// received directly from an Input don't go through the consumer middleware.
+type Input interface {
+	// Origin returns the proc that sends to this input
+	Origin() *Proc
+	// Output returns the origin output index linked to this input
+	Output() int
+	// Recv blocks until a message is received, it returns false when the
+	// input is closed or the consumer context is done
+	Recv() (Message, bool)
 }
 
 type consumer struct {
-	ctx   context.Context
-	input chan Message
+	ctx    context.Context
+	inputs []*input
 	// middleware wraps middleware func before consuming
 	middleware func(fn ConsumerFunc) ConsumerFunc
+	// done is closed when the proc stops consuming
+	done <-chan struct{}
+	stop func()
+	// drain is closed when the worker is being replaced, consuming stops
+	// as if the inputs were closed
+	drain <-chan struct{}
+	// limiter is shared by all the proc workers
+	limiter *rateLimiter
+	// node holds the proc runtime stats
+	node *node
+	// state is the worker state reported in stats
+	state *int32
+	// onErr records errors returned by the consume callbacks
+	onErr func(err error, m Message)
+	// lastErr is the last recorded error, callbacks might run in other
+	// goroutines with TimeoutConsumer
+	errMu   sync.Mutex
+	lastErr error
+	// acks of the messages being consumed, held by the messages sent
+	ackMu sync.Mutex
+	acks  acks
+
+	// select cases used to receive from multiple inputs
+	cases []reflect.SelectCase
+	open  int
 }
 
 func (c *consumer) Context() context.Context { return c.ctx }
 
+func (c *consumer) Inputs() []Input {
+	ret := make([]Input, len(c.inputs))
+	for i, in := range c.inputs {
+		ret[i] = consumerInput{in, c}
+	}
+	return ret
+}
+
 // Consume will pass the consumer function through the middleware stack and
 // call the fn for every value received, returning an error will pass error
-// through and break the reader loop.
+// through and break the reader loop, returning ErrStop stops the proc and
+// Consume returns ErrStop.
 func (c *consumer) Consume(ifn interface{}) error {
-	fn := makeConsumerFunc(ifn)
+	fn := c.recordErr(makeConsumerFunc(ifn))
 	if c.middleware != nil {
 		fn = c.middleware(fn)
 	}
 	for {
+		c.setState(WorkerIdle)
+		v, ok, _ := c.recv(nil)
+		c.setState(WorkerBusy)
+		if !ok {
+			return c.stopErr()
+		}
+		if err := c.consume(func() error { return fn(v) }, v); err != nil {
+			return c.wrapErr(err, v)
+		}
+	}
+}
+
+// ConsumeBatch groups received values in batches of up to size and calls fn
+// for each batch, a partial batch is flushed when maxWait elapses since its
+// first value or when the input is closed, maxWait <= 0 disables the timer.
+// Middlewares wrap the batch call so a retry retries the whole batch.
+func (c *consumer) ConsumeBatch(size int, maxWait time.Duration, ifn interface{}) error {
+	batchFn := makeBatchFunc(ifn)
+	fn := func(ms []Message) error {
+		err := batchFn(ms)
+		if err != nil && !errors.Is(err, ErrStop) && c.onErr != nil {
+			var m Message
+			if len(ms) > 0 {
+				m = ms[0]
+			}
+			c.setLastErr(err, m)
+		}
+		return err
+	}
+	if size <= 0 {
+		size = 1
+	}
+	batch := make([]Message, 0, size)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		b := batch
+		// fn might hold the slice so we start a new one
+		batch = make([]Message, 0, size)
+		// the call only captures b, middlewares like TimeoutConsumer might
+		// abandon it in the background
+		call := ConsumerFunc(func(Message) error { return fn(b) })
+		if c.middleware != nil {
+			call = c.middleware(call)
+		}
+		return c.consume(func() error { return call(batchMessage(b)) }, b...)
+	}
+
+	var timer *time.Timer
+	var timeout <-chan time.Time
+	stopTimer := func() {
+		if timer != nil {
+			timer.Stop()
+		}
+		timer, timeout = nil, nil
+	}
+	defer stopTimer()
+	for {
+		c.setState(WorkerIdle)
+		v, ok, timedOut := c.recv(timeout)
+		c.setState(WorkerBusy)
+		switch {
+		case timedOut:
+			stopTimer()
+			if err := flush(); err != nil {
+				return c.wrapErr(err, nil)
+			}
+			continue
+		case !ok && c.ctx.Err() != nil:
+			return nil
+		case !ok && c.isDone():
+			return ErrStop
+		case !ok:
+			return c.wrapErr(flush(), nil)
+		}
+		batch = append(batch, v)
+		if len(batch) == size {
+			if err := flush(); err != nil {
+				return c.wrapErr(err, v)
+			}
+		}
+		switch {
+		case len(batch) == 0:
+			stopTimer()
+		case timer == nil && maxWait > 0:
+			timer = time.NewTimer(maxWait)
+			timeout = timer.C
+		}
+	}
+}
+
+// batchMessage returns the message passed to the middlewares for a batch
+// call, with the first message origin and the values of ms.
+func batchMessage(ms []Message) Message {
+	vs := make([]interface{}, len(ms))
+	for i, m := range ms {
+		vs[i] = m.Value()
+	}
+	return message{origin: ms[0].Origin(), value: vs, ctx: ms[0].Context()}
+}
+
+// recordErr wraps fn to record the errors it returns in the line history.
+func (c *consumer) recordErr(fn ConsumerFunc) ConsumerFunc {
+	if c.onErr == nil {
+		return fn
+	}
+	return func(m Message) error {
+		err := fn(m)
+		if err != nil && !errors.Is(err, ErrStop) {
+			c.setLastErr(err, m)
+		}
+		return err
+	}
+}
+
+func (c *consumer) setLastErr(err error, m Message) {
+	c.onErr(err, m)
+	c.errMu.Lock()
+	c.lastErr = err
+	c.errMu.Unlock()
+}
+
+// recorded returns true if err wraps the last recorded error.
+func (c *consumer) recorded(err error) bool {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	return c.lastErr != nil && errors.Is(err, c.lastErr)
+}
+
+// wait blocks while the proc is paused, messages stay in the input channels
+// so senders block once they're full. It returns a channel closed when the
+// proc is paused again.
+func (c *consumer) wait() <-chan struct{} {
+	if c.node == nil {
+		return nil
+	}
+	for {
+		paused, resume := c.node.pauseState()
+		if resume == nil {
+			return paused
+		}
+		c.setState(WorkerPaused)
 		select {
+		case <-resume:
+			c.setState(WorkerIdle)
 		case <-c.ctx.Done():
 			return nil
-		case v, ok := <-c.input:
+		case <-c.done:
+			return nil
+		case <-c.drain:
+			return nil
+		}
+	}
+}
+
+func (c *consumer) setState(s WorkerState) {
+	if c.state != nil {
+		atomic.StoreInt32(c.state, int32(s))
+	}
+}
+
+// wrapErr adds the message origin to err, if err is ErrStop the proc is
+// stopped and ErrStop is returned as is.
+func (c *consumer) wrapErr(err error, m Message) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrStop):
+		if c.stop != nil {
+			c.stop()
+		}
+		return ErrStop
+	case m == nil:
+		return err
+	}
+	return fmt.Errorf("%w, origin: %v", err, m.Origin())
+}
+
+// isDone returns true if the proc was stopped.
+func (c *consumer) isDone() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// stopErr returns ErrStop if the proc was stopped by another worker.
+func (c *consumer) stopErr() error {
+	if c.ctx.Err() == nil && c.isDone() {
+		return ErrStop
+	}
+	return nil
+}
+
+// recv returns the next message from any of the open inputs, ok is false
+// when every input is closed or the context is done and timedOut is true if
+// timeout fires before a message is received.
+func (c *consumer) recv(timeout <-chan time.Time) (m Message, ok, timedOut bool) {
+	paused := c.wait()
+	// fast path for the common single input
+	if len(c.inputs) == 1 {
+		select {
+		case <-c.ctx.Done():
+			return nil, false, false
+		case <-c.done:
+			return nil, false, false
+		case <-c.drain:
+			return nil, false, false
+		case <-timeout:
+			return nil, false, true
+		case <-paused:
+			return c.recv(timeout)
+		case m, ok := <-c.inputs[0].ch:
 			if !ok {
-				return nil
+				return nil, false, false
 			}
-			if err := fn(v); err != nil {
-				return fmt.Errorf("%w, origin: %v", err, v.Origin())
+			m, ok = c.deliver(m)
+			return m, ok, false
+		}
+	}
+
+	if c.cases == nil {
+		c.cases = make([]reflect.SelectCase, 5, len(c.inputs)+5)
+		c.cases[0] = reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(c.ctx.Done()),
+		}
+		c.cases[1] = reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(c.done),
+		}
+		c.cases[2] = reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(c.drain),
+		}
+		for _, in := range c.inputs {
+			c.cases = append(c.cases, reflect.SelectCase{
+				Dir:  reflect.SelectRecv,
+				Chan: reflect.ValueOf(in.ch),
+			})
+		}
+		c.open = len(c.inputs)
+	}
+	c.cases[3] = reflect.SelectCase{
+		Dir:  reflect.SelectRecv,
+		Chan: reflect.ValueOf(timeout),
+	}
+	c.cases[4] = reflect.SelectCase{
+		Dir:  reflect.SelectRecv,
+		Chan: reflect.ValueOf(paused),
+	}
+	for c.open > 0 {
+		i, v, ok := reflect.Select(c.cases)
+		switch {
+		case i <= 2:
+			return nil, false, false
+		case i == 3:
+			return nil, false, true
+		case i == 4:
+			return c.recv(timeout)
+		case !ok:
+			// a zero Chan disables the case
+			c.cases[i].Chan = reflect.Value{}
+			c.open--
+			continue
+		}
+		m, ok := c.deliver(v.Interface().(Message))
+		return m, ok, false
+	}
+	return nil, false, false
+}
+
+// deliver waits for the proc rate limiter and sets the consumer context in
+// the message, it returns false if the context is done while waiting.
+func (c *consumer) deliver(m Message) (Message, bool) {
+	if c.limiter != nil {
+		if err := c.limiter.wait(c.ctx); err != nil {
+			return nil, false
+		}
+	}
+	if c.node != nil {
+		atomic.AddInt64(&c.node.received, 1)
+	}
+	return withContext(m, c.ctx), true
+}
+
+type consumerInput struct {
+	*input
+	c *consumer
+}
+
+func (i consumerInput) Origin() *Proc { return i.origin }
+func (i consumerInput) Output() int   { return i.output }
+
+// Recv goes through the same pause, rate limit and stats as Consume.
+func (i consumerInput) Recv() (Message, bool) {
+	c := i.c
+	c.setState(WorkerIdle)
+	defer c.setState(WorkerBusy)
+	for {
+		paused := c.wait()
+		select {
+		case <-c.ctx.Done():
+			return nil, false
+		case <-i.done:
+			return nil, false
+		case <-c.drain:
+			return nil, false
+		case <-paused:
+			continue
+		case m, ok := <-i.ch:
+			if !ok {
+				return nil, false
 			}
+			if m, ok = c.deliver(m); !ok {
+				return nil, false
+			}
+			// messages sent until Ack is called derive from m
+			c.track(messageAcks(m))
+			return m, true
 		}
 	}
 }
@@ -66,10 +439,48 @@ func makeConsumerFunc(fn interface{}) ConsumerFunc {
 		!fnTyp.Out(0).Implements(reflect.TypeOf((*error)(nil)).Elem()) {
 		panic("consume param should be 'func(t T) error'")
 	}
-	args := make([]reflect.Value, 1)
+	// args are allocated per call, calls abandoned by TimeoutConsumer can
+	// still be running
 	return func(m Message) error {
-		args[0] = reflect.ValueOf(m.Value())
-		ret := fnVal.Call(args)
+		ret := fnVal.Call([]reflect.Value{reflect.ValueOf(m.Value())})
+		if err, ok := ret[0].Interface().(error); ok && err != nil {
+			return err
+		}
+		return nil
+	}
+}
+
+func makeBatchFunc(fn interface{}) func(ms []Message) error {
+	switch fn := fn.(type) {
+	case func(ms []Message) error:
+		return fn
+	case func(vs []interface{}) error:
+		return func(ms []Message) error {
+			vs := make([]interface{}, len(ms))
+			for i, m := range ms {
+				vs[i] = m.Value()
+			}
+			return fn(vs)
+		}
+	}
+
+	fnVal := reflect.ValueOf(fn)
+	fnTyp := fnVal.Type()
+	if fnTyp.NumIn() != 1 ||
+		fnTyp.In(0).Kind() != reflect.Slice ||
+		fnTyp.NumOut() != 1 ||
+		!fnTyp.Out(0).Implements(reflect.TypeOf((*error)(nil)).Elem()) {
+		panic("consume batch param should be 'func(t []T) error'")
+	}
+	sliceTyp := fnTyp.In(0)
+	return func(ms []Message) error {
+		s := reflect.MakeSlice(sliceTyp, len(ms), len(ms))
+		for i, m := range ms {
+			if v := m.Value(); v != nil {
+				s.Index(i).Set(reflect.ValueOf(v))
+			}
+		}
+		ret := fnVal.Call([]reflect.Value{s})
 		if err, ok := ret[0].Interface().(error); ok && err != nil {
 			return err
 		}
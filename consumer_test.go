@@ -5,6 +5,7 @@ import (
 	"errors"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestConsumer(t *testing.T) {
@@ -63,7 +64,7 @@ func TestConsumer(t *testing.T) {
 				}
 			}()
 
-			c := &consumer{ctx: ctx, input: ch, middleware: tt.middleware}
+			c := &consumer{ctx: ctx, inputs: []*input{{ch: ch}}, middleware: tt.middleware}
 
 			var res []interface{}
 
@@ -86,3 +87,144 @@ func TestConsumer(t *testing.T) {
 		})
 	}
 }
+
+func TestConsumerBatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		size       int
+		maxWait    time.Duration
+		sender     func(context.Context, chan Message)
+		middleware ConsumerMiddleware
+		fn         func(t *testing.T, res *[][]int) interface{}
+		wantErr    string
+		wantRes    [][]int
+	}{
+		{
+			name: "flush on size and close",
+			size: 4,
+			sender: func(_ context.Context, ch chan Message) {
+				for i := 0; i < 10; i++ {
+					ch <- message{value: i}
+				}
+			},
+			wantRes: [][]int{{0, 1, 2, 3}, {4, 5, 6, 7}, {8, 9}},
+		},
+		{
+			name:    "flush on timeout",
+			size:    4,
+			maxWait: 10 * time.Millisecond,
+			sender: func(_ context.Context, ch chan Message) {
+				for i := 0; i < 6; i++ {
+					if i == 2 {
+						time.Sleep(50 * time.Millisecond)
+					}
+					ch <- message{value: i}
+				}
+			},
+			wantRes: [][]int{{0, 1}, {2, 3, 4, 5}},
+		},
+		{
+			name: "messages",
+			size: 2,
+			sender: func(_ context.Context, ch chan Message) {
+				for i := 0; i < 3; i++ {
+					ch <- message{value: i}
+				}
+			},
+			fn: func(t *testing.T, res *[][]int) interface{} {
+				return func(ms []Message) error {
+					b := []int{}
+					for _, m := range ms {
+						b = append(b, m.Value().(int))
+					}
+					*res = append(*res, b)
+					return nil
+				}
+			},
+			wantRes: [][]int{{0, 1}, {2}},
+		},
+		{
+			name: "error",
+			size: 2,
+			sender: func(_ context.Context, ch chan Message) {
+				for i := 0; i < 3; i++ {
+					ch <- message{value: i}
+				}
+			},
+			fn: func(t *testing.T, res *[][]int) interface{} {
+				return func([]int) error { return errors.New("test") }
+			},
+			wantErr: "test, origin: <nil>",
+		},
+		{
+			name: "retry middleware retries the batch",
+			size: 2,
+			sender: func(_ context.Context, ch chan Message) {
+				for i := 0; i < 3; i++ {
+					ch <- message{value: i}
+				}
+			},
+			middleware: RetryConsumer(3),
+			fn: func(t *testing.T, res *[][]int) interface{} {
+				calls := 0
+				return func(vs []int) error {
+					if calls++; calls == 1 {
+						return errors.New("test")
+					}
+					*res = append(*res, vs)
+					return nil
+				}
+			},
+			wantRes: [][]int{{0, 1}, {2}},
+		},
+		{
+			name: "timeout middleware abandons the batch",
+			size: 2,
+			sender: func(_ context.Context, ch chan Message) {
+				for i := 0; i < 3; i++ {
+					ch <- message{value: i}
+				}
+			},
+			middleware: TimeoutConsumer(time.Millisecond),
+			fn: func(t *testing.T, res *[][]int) interface{} {
+				release := make(chan struct{})
+				t.Cleanup(func() { close(release) })
+				return func(vs []int) error {
+					<-release
+					return nil
+				}
+			},
+			wantErr: "consumer timeout after 1ms, origin: <nil>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			ch := make(chan Message)
+			go func() {
+				defer close(ch)
+				tt.sender(ctx, ch)
+			}()
+
+			c := &consumer{ctx: ctx, inputs: []*input{{ch: ch}}, middleware: tt.middleware}
+
+			var res [][]int
+			var fn interface{} = func(vs []int) error {
+				res = append(res, vs)
+				return nil
+			}
+			if tt.fn != nil {
+				fn = tt.fn(t, &res)
+			}
+
+			err := c.ConsumeBatch(tt.size, tt.maxWait, fn)
+			if want := tt.wantErr; (err == nil && want != "") || (err != nil && err.Error() != want) {
+				t.Errorf("\nwant: %v\n got: %v\n", want, err)
+			}
+			if want := tt.wantRes; !reflect.DeepEqual(res, want) {
+				t.Errorf("\nwant: %v\n got: %v\n", want, res)
+			}
+		})
+	}
+}
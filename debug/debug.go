@@ -0,0 +1,257 @@
+// Package debug serves the state of a running line over HTTP, it can be
+// mounted on any mux to inspect a pipeline without attaching a debugger:
+//
+//	l := origin.Start(ctx, pipe.WithSampling(100, 10))
+//	http.Handle("/debug/pipe/", http.StripPrefix("/debug/pipe", debug.Handler(l)))
+//
+// Routes:
+//
+//	/            text summary of procs and recent errors
+//	/graph       graph annotated with stats, ?format=dot (default), mermaid or json
+//	/stats       procs stats and worker states as JSON
+//	/errors      recent errors as JSON
+//	/tail        sampled messages per link as JSON, requires pipe.WithSampling
+//	/goroutines  stacks of the line workers grouped by proc
+package debug
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/tabwriter"
+	"time"
+
+	"github.com/stdiopt/pipe"
+)
+
+// Option configures the debug handler.
+type Option func(h *handler)
+
+// WithRedact transforms sampled values before they are served, pipe.RedactType
+// can be used to only show the value types.
+func WithRedact(fn func(v interface{}) interface{}) Option {
+	return func(h *handler) { h.redact = fn }
+}
+
+type handler struct {
+	line   *pipe.Line
+	redact func(v interface{}) interface{}
+	mux    *http.ServeMux
+}
+
+// Handler returns an http.Handler that serves the state of l.
+func Handler(l *pipe.Line, opts ...Option) http.Handler {
+	h := &handler{line: l, mux: http.NewServeMux()}
+	for _, fn := range opts {
+		fn(h)
+	}
+	h.mux.HandleFunc("/", h.index)
+	h.mux.HandleFunc("/graph", h.graph)
+	h.mux.HandleFunc("/stats", h.stats)
+	h.mux.HandleFunc("/errors", h.errors)
+	h.mux.HandleFunc("/tail", h.tail)
+	h.mux.HandleFunc("/goroutines", h.goroutines)
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *handler) index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	stats := h.line.Stats()
+	ids := procIDs(stats)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROC\tRUNNING\tRECEIVED\tSENT\tRATE\tERRORS\tSKIPPED\tQUEUE\tBLOCKED")
+	for _, s := range stats {
+		qlen, qcap, blocked := 0, 0, 0
+		for _, in := range s.Inputs {
+			qlen += in.Len
+			qcap += in.Cap
+			blocked += in.Blocked
+		}
+		fmt.Fprintf(tw, "%s\t%d/%d\t%d\t%d\t%.1f/s\t%d\t%d\t%d/%d\t%d\n",
+			s.ID, s.Running, s.Workers, s.Received, s.Sent, s.Rate,
+			s.Errors, s.Skipped, qlen, qcap, blocked,
+		)
+	}
+	tw.Flush()
+
+	errs := h.line.Errors()
+	if len(errs) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\nRECENT ERRORS")
+	for _, e := range errs {
+		fmt.Fprintf(w, "%s %s: %v\n", e.Time.Format(time.RFC3339), ids[e.Proc], e.Err)
+	}
+}
+
+func (h *handler) graph(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	switch f := r.URL.Query().Get("format"); f {
+	case "", "dot":
+		fmt.Fprint(w, pipe.DumpLiveDOT(h.line))
+	case "mermaid":
+		fmt.Fprint(w, pipe.DumpMermaid(h.line.Root()))
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, pipe.DumpJSON(h.line.Root()))
+	default:
+		http.Error(w, fmt.Sprintf("unknown format %q", f), http.StatusBadRequest)
+	}
+}
+
+type procStats struct {
+	ID       string       `json:"id"`
+	Workers  int          `json:"workers"`
+	Running  int          `json:"running"`
+	States   []string     `json:"states"`
+	Paused   bool         `json:"paused,omitempty"`
+	Received int64        `json:"received"`
+	Sent     int64        `json:"sent"`
+	Errors   int64        `json:"errors"`
+	Skipped  int64        `json:"skipped"`
+	Rate     float64      `json:"rate"`
+	Inputs   []inputStats `json:"inputs,omitempty"`
+}
+
+type inputStats struct {
+	Origin  string `json:"origin"`
+	Output  int    `json:"output"`
+	Sent    int64  `json:"sent"`
+	Len     int    `json:"len"`
+	Cap     int    `json:"cap"`
+	Blocked int    `json:"blocked"`
+}
+
+func (h *handler) stats(w http.ResponseWriter, r *http.Request) {
+	stats := h.line.Stats()
+	ids := procIDs(stats)
+
+	ret := make([]procStats, 0, len(stats))
+	for _, s := range stats {
+		ps := procStats{
+			ID:       s.ID,
+			Workers:  s.Workers,
+			Running:  s.Running,
+			States:   make([]string, len(s.States)),
+			Paused:   s.Paused,
+			Received: s.Received,
+			Sent:     s.Sent,
+			Errors:   s.Errors,
+			Skipped:  s.Skipped,
+			Rate:     s.Rate,
+		}
+		for i, st := range s.States {
+			ps.States[i] = st.String()
+		}
+		for _, in := range s.Inputs {
+			ps.Inputs = append(ps.Inputs, inputStats{
+				Origin:  ids[in.Origin],
+				Output:  in.Output,
+				Sent:    in.Sent,
+				Len:     in.Len,
+				Cap:     in.Cap,
+				Blocked: in.Blocked,
+			})
+		}
+		ret = append(ret, ps)
+	}
+	writeJSON(w, ret)
+}
+
+type errorRecord struct {
+	Time   time.Time `json:"time"`
+	Proc   string    `json:"proc"`
+	Origin string    `json:"origin,omitempty"`
+	Error  string    `json:"error"`
+}
+
+func (h *handler) errors(w http.ResponseWriter, r *http.Request) {
+	ids := procIDs(h.line.Stats())
+
+	errs := h.line.Errors()
+	ret := make([]errorRecord, 0, len(errs))
+	for _, e := range errs {
+		ret = append(ret, errorRecord{
+			Time:   e.Time,
+			Proc:   ids[e.Proc],
+			Origin: ids[e.Origin],
+			Error:  e.Err.Error(),
+		})
+	}
+	writeJSON(w, ret)
+}
+
+type edgeTail struct {
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	Output  int      `json:"output"`
+	Samples []sample `json:"samples"`
+}
+
+type sample struct {
+	Time  time.Time `json:"time"`
+	Value string    `json:"value"`
+}
+
+func (h *handler) tail(w http.ResponseWriter, r *http.Request) {
+	stats := h.line.Stats()
+	ids := procIDs(stats)
+
+	ret := []edgeTail{}
+	for _, s := range stats {
+		for _, in := range s.Inputs {
+			e := edgeTail{
+				From:    ids[in.Origin],
+				To:      s.ID,
+				Output:  in.Output,
+				Samples: make([]sample, 0, len(in.Samples)),
+			}
+			for _, smp := range in.Samples {
+				v := smp.Value
+				if h.redact != nil {
+					v = h.redact(v)
+				}
+				e.Samples = append(e.Samples, sample{
+					Time:  smp.Time,
+					Value: fmt.Sprintf("%v", v),
+				})
+			}
+			ret = append(ret, e)
+		}
+	}
+	writeJSON(w, ret)
+}
+
+func (h *handler) goroutines(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err := h.line.DumpGoroutines(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// procIDs maps procs to the ids used in the graph dumps.
+func procIDs(stats []pipe.ProcStats) map[*pipe.Proc]string {
+	ids := map[*pipe.Proc]string{}
+	for _, s := range stats {
+		ids[s.Proc] = s.ID
+	}
+	return ids
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
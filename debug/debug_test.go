@@ -0,0 +1,122 @@
+package debug_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stdiopt/pipe"
+	"github.com/stdiopt/pipe/debug"
+)
+
+func TestHandler(t *testing.T) {
+	origin := pipe.NewProc(
+		pipe.WithName("origin"),
+		pipe.WithFunc(func(s pipe.Sender) error {
+			for i := 1; i <= 5; i++ {
+				if err := s.Send(i); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	)
+	pipe.NewProc(
+		pipe.WithName("sink"),
+		pipe.WithSource(0, origin),
+		pipe.WithFunc(func(c pipe.Consumer) error {
+			return c.Consume(func(v int) error {
+				if v == 5 {
+					return errors.New("boom")
+				}
+				return nil
+			})
+		}),
+	)
+	l := origin.Start(context.Background(), pipe.WithSampling(1, 2))
+	if err := l.Wait(); err == nil {
+		t.Fatal("expected error")
+	}
+	h := debug.Handler(l, debug.WithRedact(func(v interface{}) interface{} {
+		return v.(int) * 10
+	}))
+
+	get := func(path string) string {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec.Body.String()
+	}
+
+	t.Run("stats", func(t *testing.T) {
+		type stats struct {
+			ID       string
+			States   []string
+			Received int
+			Sent     int
+			Errors   int
+		}
+		got := []stats{}
+		if err := json.Unmarshal([]byte(get("/stats")), &got); err != nil {
+			t.Fatal(err)
+		}
+		want := []stats{
+			{ID: "origin", States: []string{"done"}, Sent: 5},
+			{ID: "sink", States: []string{"done"}, Received: 5, Errors: 1},
+		}
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("\nwant: %+v\n got: %+v\n", want, got)
+		}
+	})
+	t.Run("errors", func(t *testing.T) {
+		type record struct {
+			Proc   string
+			Origin string
+			Error  string
+		}
+		got := []record{}
+		if err := json.Unmarshal([]byte(get("/errors")), &got); err != nil {
+			t.Fatal(err)
+		}
+		want := []record{{Proc: "sink", Origin: "origin", Error: "boom"}}
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("\nwant: %+v\n got: %+v\n", want, got)
+		}
+	})
+	t.Run("tail", func(t *testing.T) {
+		type edge struct {
+			From, To string
+			Samples  []struct{ Value string }
+		}
+		got := []edge{}
+		if err := json.Unmarshal([]byte(get("/tail")), &got); err != nil {
+			t.Fatal(err)
+		}
+		if want, got := 1, len(got); want != got {
+			t.Fatalf("\nwant: %v\n got: %v\n", want, got)
+		}
+		values := []string{}
+		for _, s := range got[0].Samples {
+			values = append(values, s.Value)
+		}
+		if want, got := []string{"40", "50"}, values; !reflect.DeepEqual(want, got) {
+			t.Errorf("\nwant: %v\n got: %v\n", want, got)
+		}
+	})
+	t.Run("graph", func(t *testing.T) {
+		for path, want := range map[string]string{
+			"/graph":                `"origin" -> "sink" [label="sent: 5"]`,
+			"/graph?format=mermaid": "n0 --> n1",
+			"/graph?format=json":    `"from": "origin"`,
+			"/graph?format=svg":     `unknown format "svg"`,
+			"/":                     "sink: boom",
+		} {
+			if got := get(path); !strings.Contains(got, want) {
+				t.Errorf("%s\nwant: %v\n got: %v\n", path, want, got)
+			}
+		}
+	})
+}
@@ -0,0 +1,261 @@
+package pipe
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DedupStore keeps track of the keys already consumed by DedupConsumer.
+type DedupStore interface {
+	// Has returns true if key was added before
+	Has(key string) (bool, error)
+	// Add marks key as seen
+	Add(key string) error
+}
+
+// DedupConsumer consumer middleware that skips messages whose key, returned
+// by keyFn, is already in store, keys are added to the store once the
+// message is consumed without error. With ConsumeBatch keyFn receives the
+// batch values as a []interface{}.
+//
+// Keys being consumed are reserved so workers receiving the same key wait
+// for the first one, and skip the message if it was consumed without error.
+func DedupConsumer(keyFn func(v interface{}) string, store DedupStore) ConsumerMiddleware {
+	inflight := &inflightKeys{keys: map[string]chan struct{}{}}
+	return func(fn ConsumerFunc) ConsumerFunc {
+		return func(m Message) error {
+			key := keyFn(m.Value())
+			seen, err := inflight.reserve(m.Context(), key, store)
+			if err != nil {
+				return errFatal{err}
+			}
+			if seen {
+				if n := nodeFromContext(m.Context()); n != nil {
+					atomic.AddInt64(&n.skipped, 1)
+				}
+				logger, kv := loggerFrom(m.Context())
+				logger.Log(LevelDebug, "duplicate skipped", append(kv,
+					"origin", logProc(m.Origin()),
+					"key", key,
+				)...)
+				return nil
+			}
+			defer inflight.release(key)
+			if err := fn(m); err != nil {
+				return err
+			}
+			if err := store.Add(key); err != nil {
+				return errFatal{err}
+			}
+			return nil
+		}
+	}
+}
+
+// inflightKeys are the keys being consumed by DedupConsumer workers.
+type inflightKeys struct {
+	mu   sync.Mutex
+	keys map[string]chan struct{}
+}
+
+// reserve waits until key isn't being consumed and reserves it, it returns
+// true without reserving if key is in store.
+func (k *inflightKeys) reserve(ctx context.Context, key string, store DedupStore) (bool, error) {
+	for {
+		k.mu.Lock()
+		done, busy := k.keys[key]
+		if !busy {
+			seen, err := store.Has(key)
+			if err == nil && !seen {
+				k.keys[key] = make(chan struct{})
+			}
+			k.mu.Unlock()
+			return seen, err
+		}
+		k.mu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+}
+
+// release releases key once it's added to the store or its consume failed.
+func (k *inflightKeys) release(key string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	close(k.keys[key])
+	delete(k.keys, key)
+}
+
+type lruStore struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	keys  map[string]*list.Element
+}
+
+// NewLRUStore returns an in memory DedupStore that keeps the last size keys
+// seen.
+func NewLRUStore(size int) DedupStore {
+	return &lruStore{
+		size:  size,
+		order: list.New(),
+		keys:  map[string]*list.Element{},
+	}
+}
+
+func (s *lruStore) Has(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.keys[key]
+	if ok {
+		s.order.MoveToFront(el)
+	}
+	return ok, nil
+}
+
+func (s *lruStore) Add(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.keys[key]; ok {
+		s.order.MoveToFront(el)
+		return nil
+	}
+	s.keys[key] = s.order.PushFront(key)
+	for s.size > 0 && s.order.Len() > s.size {
+		el := s.order.Back()
+		s.order.Remove(el)
+		delete(s.keys, el.Value.(string))
+	}
+	return nil
+}
+
+type ttlStore struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	keys  map[string]time.Time
+	swept time.Time
+}
+
+// NewTTLStore returns an in memory DedupStore that forgets keys after ttl.
+func NewTTLStore(ttl time.Duration) DedupStore {
+	return &ttlStore{
+		ttl:   ttl,
+		keys:  map[string]time.Time{},
+		swept: time.Now(),
+	}
+}
+
+func (s *ttlStore) Has(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	exp, ok := s.keys[key]
+	return ok && time.Now().Before(exp), nil
+}
+
+func (s *ttlStore) Add(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.keys[key] = now.Add(s.ttl)
+	// sweep expired keys at most once per ttl
+	if now.Sub(s.swept) < s.ttl {
+		return nil
+	}
+	for k, exp := range s.keys {
+		if !now.Before(exp) {
+			delete(s.keys, k)
+		}
+	}
+	s.swept = now
+	return nil
+}
+
+// FileStore is a DedupStore that appends keys to a file so they survive
+// process restarts.
+type FileStore struct {
+	mu   sync.Mutex
+	f    *os.File
+	keys map[string]struct{}
+}
+
+// NewFileStore opens or creates the file at path and loads the keys
+// previously stored, a last line without newline left by an interrupted Add
+// is truncated.
+func NewFileStore(path string) (*FileStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s := &FileStore{f: f, keys: map[string]struct{}{}}
+	if err := s.load(path); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileStore) load(path string) error {
+	r := bufio.NewReader(s.f)
+	offset := int64(0)
+	for n := 1; ; n++ {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			if line == "" {
+				return nil
+			}
+			if err := s.f.Truncate(offset); err != nil {
+				return fmt.Errorf("dedup store %s: %w", path, err)
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("dedup store %s: %w", path, err)
+		}
+		key, err := strconv.Unquote(strings.TrimSuffix(line, "\n"))
+		if err != nil {
+			return fmt.Errorf("dedup store %s: line %d: %w", path, n, err)
+		}
+		s.keys[key] = struct{}{}
+		offset += int64(len(line))
+	}
+}
+
+// Has implements DedupStore.
+func (s *FileStore) Has(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.keys[key]
+	return ok, nil
+}
+
+// Add implements DedupStore.
+func (s *FileStore) Add(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[key]; ok {
+		return nil
+	}
+	// keys are quoted so they can't break lines
+	if _, err := s.f.WriteString(strconv.Quote(key) + "\n"); err != nil {
+		return err
+	}
+	s.keys[key] = struct{}{}
+	return nil
+}
+
+// Close closes the underlying file.
+func (s *FileStore) Close() error {
+	return s.f.Close()
+}
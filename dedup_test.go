@@ -0,0 +1,210 @@
+package pipe_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stdiopt/pipe"
+)
+
+func TestDedupConsumer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "keys")
+
+	run := func(store pipe.DedupStore, vs ...int) []int {
+		origin := pipe.NewProc(
+			pipe.WithFunc(func(s pipe.Sender) error {
+				for _, v := range vs {
+					if err := s.Send(v); err != nil {
+						return err
+					}
+				}
+				return nil
+			}),
+		)
+		res := []int{}
+		pipe.NewProc(
+			pipe.WithSource(0, origin),
+			pipe.WithConsumerMiddleware(
+				pipe.DedupConsumer(func(v interface{}) string { return fmt.Sprint(v) }, store),
+			),
+			pipe.WithFunc(func(c pipe.Consumer) error {
+				return c.Consume(func(v int) error {
+					res = append(res, v)
+					return nil
+				})
+			}),
+		)
+		if err := origin.Run(); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	tests := []struct {
+		name    string
+		store   func() pipe.DedupStore
+		wantRes []int
+	}{
+		{
+			name:    "lru",
+			store:   func() pipe.DedupStore { return pipe.NewLRUStore(2) },
+			wantRes: []int{1, 2, 3, 2, 1},
+		},
+		{
+			name:    "ttl",
+			store:   func() pipe.DedupStore { return pipe.NewTTLStore(time.Minute) },
+			wantRes: []int{1, 2, 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := run(tt.store(), 1, 2, 1, 3, 2, 1)
+			if want := tt.wantRes; !reflect.DeepEqual(res, want) {
+				t.Errorf("\nwant: %v\n got: %v\n", want, res)
+			}
+		})
+	}
+
+	t.Run("file", func(t *testing.T) {
+		store, err := pipe.NewFileStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := run(store, 1, 2, 1)
+		if want := []int{1, 2}; !reflect.DeepEqual(res, want) {
+			t.Errorf("\nwant: %v\n got: %v\n", want, res)
+		}
+		store.Close()
+
+		// reopen to check keys were persisted
+		store, err = pipe.NewFileStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+		res = run(store, 2, 3, 1)
+		if want := []int{3}; !reflect.DeepEqual(res, want) {
+			t.Errorf("\nwant: %v\n got: %v\n", want, res)
+		}
+	})
+}
+
+func TestFileStoreLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		wantKeys []string
+		wantFile string
+		wantErr  string
+	}{
+		{
+			name:     "torn last line",
+			content:  "\"a\"\n\"b",
+			wantKeys: []string{"a"},
+			wantFile: "\"a\"\n\"c\"\n",
+		},
+		{
+			name:     "last line without newline",
+			content:  "\"a\"\n\"b\"",
+			wantKeys: []string{"a"},
+			wantFile: "\"a\"\n\"c\"\n",
+		},
+		{
+			name:    "bad line",
+			content: "\"a\"\nb\n\"c\"\n",
+			wantErr: "line 2: invalid syntax",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "dedup")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "keys")
+			if err := ioutil.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			store, err := pipe.NewFileStore(path)
+			if tt.wantErr != "" {
+				want := path + ": " + tt.wantErr
+				if err == nil || !strings.Contains(err.Error(), want) {
+					t.Errorf("\nwant: %v\n got: %v\n", want, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, k := range tt.wantKeys {
+				if ok, _ := store.Has(k); !ok {
+					t.Errorf("missing key %q", k)
+				}
+			}
+			if err := store.Add("c"); err != nil {
+				t.Fatal(err)
+			}
+			store.Close()
+
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := tt.wantFile; string(b) != want {
+				t.Errorf("\nwant: %q\n got: %q\n", want, string(b))
+			}
+		})
+	}
+}
+
+func TestDedupConsumerWorkers(t *testing.T) {
+	origin := pipe.NewProc(
+		pipe.WithFunc(func(s pipe.Sender) error {
+			for i := 0; i < 40; i++ {
+				if err := s.Send(i % 2); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	)
+	var mu sync.Mutex
+	calls := map[int]int{}
+	pipe.NewProc(
+		pipe.WithSource(0, origin),
+		pipe.WithWorkers(4),
+		pipe.WithConsumerMiddleware(
+			pipe.DedupConsumer(func(v interface{}) string { return fmt.Sprint(v) }, pipe.NewLRUStore(10)),
+		),
+		pipe.WithFunc(func(c pipe.Consumer) error {
+			return c.Consume(func(v int) error {
+				// slow consumers let other workers receive the same key
+				time.Sleep(time.Millisecond)
+				mu.Lock()
+				defer mu.Unlock()
+				calls[v]++
+				return nil
+			})
+		}),
+	)
+	if err := origin.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[int]int{0: 1, 1: 1}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, calls)
+	}
+}
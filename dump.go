@@ -2,101 +2,386 @@ package pipe
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
-	"io"
+	"reflect"
+	"runtime"
+	"sort"
 	"strings"
 )
 
 // DumpDOT a proc line in graphviz dot language format
 func DumpDOT(p *Proc) string {
+	g := newGraph(p)
 	buf := bytes.NewBuffer(nil)
 
 	fmt.Fprintf(buf, "digraph {\n")
 	fmt.Fprintln(buf, "\t"+`node[shape=square, style="filled,rounded", width=1, color="#aaaaaa"]`)
-	d := &dotWriter{}
-	d.links(buf, p)
+	for _, e := range g.Edges {
+		fmt.Fprintf(buf, "\t%q -> %q", e.From, e.To)
+		if e.Label != "" {
+			fmt.Fprintf(buf, " [label=%q]", e.Label)
+		}
+		fmt.Fprintln(buf)
+	}
+	for i, n := range g.Nodes {
+		if n.Composite {
+			continue
+		}
+		if style := n.dotStyle(i == 0); style != "" {
+			fmt.Fprintf(buf, "\t%q[%s]\n", n.ID, style)
+		}
+	}
+	g.dotClusters(buf, "", "\t")
+	fmt.Fprintf(buf, "}\n")
+	return buf.String()
+}
 
-	for k, v := range d.style {
-		fmt.Fprintf(buf, "\t%q[%s]\n", k, v)
+// DumpLiveDOT a running line in graphviz dot language format, nodes are
+// annotated with the received rate, errors and queue usage and coloured by
+// the queue fill ratio, edges with the sent and blocked counts
+func DumpLiveDOT(l *Line) string {
+	g := newGraph(l.root)
+	stats := map[*Proc]ProcStats{}
+	for _, s := range l.Stats() {
+		stats[s.Proc] = s
 	}
+	buf := bytes.NewBuffer(nil)
+
+	fmt.Fprintf(buf, "digraph {\n")
+	fmt.Fprintln(buf, "\t"+`node[shape=square, style="filled,rounded", width=1, color="#aaaaaa"]`)
+	for _, e := range g.Edges {
+		label := []string{}
+		if e.Label != "" {
+			label = append(label, e.Label)
+		}
+		for _, in := range stats[e.to].Inputs {
+			if in.Origin != e.from || in.Output != e.Output {
+				continue
+			}
+			label = append(label, fmt.Sprintf("sent: %d", in.Sent))
+			if in.Blocked > 0 {
+				label = append(label, fmt.Sprintf("blocked: %d", in.Blocked))
+			}
+		}
+		fmt.Fprintf(buf, "\t%q -> %q [label=%q]\n", e.From, e.To, strings.Join(label, "\n"))
+	}
+	for _, n := range g.Nodes {
+		if n.Composite {
+			continue
+		}
+		s := stats[n.proc]
+		qlen, qcap, fill := 0, 0, 0.0
+		for _, in := range s.Inputs {
+			qlen += in.Len
+			qcap += in.Cap
+			if f := in.Fill(); f > fill {
+				fill = f
+			}
+		}
+		label := append(n.details(),
+			fmt.Sprintf("running: %d/%d", s.Running, s.Workers),
+			fmt.Sprintf("rate: %.1f msg/s", s.Rate),
+			fmt.Sprintf("errors: %d", s.Errors),
+		)
+		if len(s.Inputs) > 0 {
+			label = append(label, fmt.Sprintf("queue: %d/%d", qlen, qcap))
+		}
+		if s.Skipped > 0 {
+			label = append(label, fmt.Sprintf("skipped: %d", s.Skipped))
+		}
+		style := ""
+		if n.Sink {
+			style = "shape=circle "
+		}
+		if s.Errors > 0 {
+			style += `color="#ff0000" penwidth=2 `
+		}
+		fmt.Fprintf(buf, "\t%q[%sfillcolor=%q label=<%s<br/><br/><font point-size=\"8\">%s</font>>]\n",
+			n.ID,
+			style,
+			heatColor(fill),
+			n.ID,
+			strings.Join(label, "<br/>"),
+		)
+	}
+	g.dotClusters(buf, "", "\t")
 	fmt.Fprintf(buf, "}\n")
 	return buf.String()
 }
 
-type dotWriter struct {
-	touched map[*Proc]struct{}
-	style   map[string]string
+// heatColor returns a color from green to red for a ratio between 0 and 1.
+func heatColor(ratio float64) string {
+	switch {
+	case ratio < 0:
+		ratio = 0
+	case ratio > 1:
+		ratio = 1
+	}
+	lo, hi := 0x77, 0xee
+	r := lo + int(ratio*float64(hi-lo))
+	g := hi - int(ratio*float64(hi-lo))
+	return fmt.Sprintf("#%02x%02x%02x", r, g, lo)
+}
+
+// DumpMermaid a proc line in mermaid flowchart format
+func DumpMermaid(p *Proc) string {
+	g := newGraph(p)
+	buf := bytes.NewBuffer(nil)
+
+	ids := map[string]string{}
+	for i, n := range g.Nodes {
+		ids[n.ID] = fmt.Sprintf("n%d", i)
+	}
+	fmt.Fprintln(buf, "graph LR")
+	var nodes func(parent, indent string)
+	nodes = func(parent, indent string) {
+		for i, n := range g.Nodes {
+			if n.Parent != parent {
+				continue
+			}
+			if n.Composite {
+				fmt.Fprintf(buf, "%ssubgraph %s[\"%s\"]\n", indent, ids[n.ID], n.ID)
+				nodes(n.ID, indent+"\t")
+				fmt.Fprintf(buf, "%send\n", indent)
+				continue
+			}
+			label := strings.Join(append([]string{n.ID}, n.details()...), "<br/>")
+			label = strings.ReplaceAll(label, `"`, "#quot;")
+			open, close := "[", "]"
+			if i == 0 || n.Sink {
+				open, close = "((", "))"
+			}
+			fmt.Fprintf(buf, "%s%s%s\"%s\"%s\n", indent, ids[n.ID], open, label, close)
+		}
+	}
+	nodes("", "\t")
+	for _, e := range g.Edges {
+		if e.Label != "" {
+			fmt.Fprintf(buf, "\t%s -->|%s| %s\n", ids[e.From], e.Label, ids[e.To])
+			continue
+		}
+		fmt.Fprintf(buf, "\t%s --> %s\n", ids[e.From], ids[e.To])
+	}
+	return buf.String()
+}
+
+// DumpJSON a proc line as a JSON document with nodes and edges
+func DumpJSON(p *Proc) string {
+	b, err := json.MarshalIndent(newGraph(p), "", "  ")
+	if err != nil {
+		// graph only has basic types
+		panic(err)
+	}
+	return string(b)
+}
+
+// graph is the description of a proc line shared by the dump formats.
+type graph struct {
+	Nodes []*graphNode `json:"nodes"`
+	Edges []graphEdge  `json:"edges"`
+
+	procs map[*Proc]*graphNode
+	ids   map[string]bool
+}
+
+type graphNode struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name,omitempty"`
+	Outputs     []string `json:"outputs,omitempty"`
+	Workers     int      `json:"workers"`
+	BufSize     int      `json:"bufsize"`
+	Middlewares []string `json:"middlewares,omitempty"`
+	Sink        bool     `json:"sink,omitempty"`
+	// Parent is the id of the composite proc containing the node
+	Parent    string `json:"parent,omitempty"`
+	Composite bool   `json:"composite,omitempty"`
+
+	proc *Proc
+}
+
+type graphEdge struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Output int    `json:"output"`
+	Label  string `json:"label,omitempty"`
 
-	names     map[*Proc]string
-	nameCount int
+	from, to *Proc
 }
 
-func (d *dotWriter) nodeName(p *Proc) string {
-	if d.names == nil {
-		d.names = map[*Proc]string{}
+// newGraph walks the procs linked from p, edges are ordered by a depth first
+// walk following outputs by index.
+func newGraph(p *Proc) *graph {
+	g := &graph{
+		procs: map[*Proc]*graphNode{},
+		ids:   map[string]bool{},
 	}
-	if p.name != "" {
-		return p.name
+	g.walk(p, map[*Proc]bool{})
+	return g
+}
+
+func (g *graph) walk(p *Proc, visited map[*Proc]bool) {
+	if visited[p] {
+		return
 	}
-	if n, ok := d.names[p]; ok {
+	visited[p] = true
+	n := g.node(p)
+	if p.sub != nil {
+		for _, in := range p.sub.inputs {
+			g.walk(in, visited)
+		}
+		return
+	}
+
+	next := []*Proc{}
+	for _, k := range p.linkKeys() {
+		for _, lk := range p.links(k) {
+			t := lk.target
+			e := graphEdge{
+				From:   n.ID,
+				To:     g.node(t).ID,
+				Output: lk.output,
+				from:   lk.origin,
+				to:     t,
+			}
+			e.Label = lk.origin.outputName(lk.output)
+			g.Edges = append(g.Edges, e)
+			next = append(next, t)
+		}
+	}
+	n.Sink = len(next) == 0
+	for _, t := range next {
+		g.walk(t, visited)
+	}
+}
+
+// node returns the graph node for p, creating it if necessary.
+func (g *graph) node(p *Proc) *graphNode {
+	if n, ok := g.procs[p]; ok {
 		return n
 	}
-	d.nameCount++
-	name := fmt.Sprintf("unnamed#%d", d.nameCount)
-	d.names[p] = name
-	return name
+	parent := ""
+	if p.parent != nil {
+		parent = g.node(p.parent).ID
+	}
+	n := &graphNode{
+		ID:          g.nodeID(p),
+		Parent:      parent,
+		Composite:   p.sub != nil,
+		Name:        p.name,
+		Outputs:     p.Outputs(),
+		Workers:     p.workers(),
+		BufSize:     p.bufsize,
+		Middlewares: p.middlewareNames(),
+		proc:        p,
+	}
+	g.procs[p] = n
+	g.Nodes = append(g.Nodes, n)
+	return n
 }
 
-func (d *dotWriter) links(w io.Writer, p *Proc) {
-	name := d.nodeName(p)
-	if d.style == nil {
-		d.style = map[string]string{}
+// dotClusters writes the composite procs with parent as DOT clusters.
+func (g *graph) dotClusters(buf *bytes.Buffer, parent, indent string) {
+	for _, n := range g.Nodes {
+		if !n.Composite || n.Parent != parent {
+			continue
+		}
+		fmt.Fprintf(buf, "%ssubgraph %q {\n", indent, "cluster_"+n.ID)
+		fmt.Fprintf(buf, "%s\tlabel=%q\n", indent, n.ID)
+		for _, c := range g.Nodes {
+			if c.Parent == n.ID && !c.Composite {
+				fmt.Fprintf(buf, "%s\t%q\n", indent, c.ID)
+			}
+		}
+		g.dotClusters(buf, n.ID, indent+"\t")
+		fmt.Fprintf(buf, "%s}\n", indent)
 	}
-	if d.touched == nil {
-		d.touched = map[*Proc]struct{}{}
-		// default style
-		d.style[name] = `shape=circle, fillcolor="#77ee77"`
+}
+
+func (g *graph) nodeID(p *Proc) string {
+	id := p.name
+	if id == "" || g.ids[id] {
+		base := p.name
+		if base == "" {
+			base = "unnamed"
+		}
+		for i := 1; ; i++ {
+			id = fmt.Sprintf("%s#%d", base, i)
+			if !g.ids[id] {
+				break
+			}
+		}
 	}
-	if _, ok := d.touched[p]; ok {
-		return
+	g.ids[id] = true
+	return id
+}
+
+// details returns the node configuration lines used in labels.
+func (n *graphNode) details() []string {
+	ret := []string{}
+	if n.Workers > 1 {
+		ret = append(ret, fmt.Sprintf(`workers: %d`, n.Workers))
 	}
-	d.touched[p] = struct{}{}
+	if n.BufSize > 1 {
+		ret = append(ret, fmt.Sprintf(`bufsize: %d`, n.BufSize))
+	}
+	for _, mw := range n.Middlewares {
+		ret = append(ret, fmt.Sprintf(`mw: %s`, mw))
+	}
+	return ret
+}
 
+func (n *graphNode) dotStyle(root bool) string {
 	style := ""
-	label := []string{}
-	if len(p.targets) == 0 {
+	if n.Sink {
 		style = `shape=circle fillcolor="#aaaaff"`
 	}
-	if p.nworkers > 1 {
+	if n.Workers > 1 {
 		style += " peripheries=3"
-		label = append(label,
-			fmt.Sprintf(`workers: %d`, p.nworkers),
-		)
-	}
-	if p.bufsize > 1 {
-		label = append(label,
-			fmt.Sprintf(`bufsize: %d`, p.bufsize),
-		)
 	}
-	if len(label) != 0 {
+	if label := n.details(); len(label) != 0 {
 		style += fmt.Sprintf(` label=<%s<br/><br/><font point-size="8">%s</font>>`,
-			name,
+			n.ID,
 			strings.Join(label, "<br/>"),
 		)
 	}
+	if style == "" && root {
+		return `shape=circle, fillcolor="#77ee77"`
+	}
+	return style
+}
 
-	if style != "" {
-		d.style[name] = style
+// targetKeys returns the linked output indexes sorted.
+func (p *Proc) targetKeys() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	keys := make([]int, 0, len(p.targets))
+	for k, g := range p.targets {
+		if len(g) > 0 {
+			keys = append(keys, k)
+		}
 	}
+	sort.Ints(keys)
+	return keys
+}
 
-	for i, group := range p.targets {
-		for _, o := range group {
-			d.links(w, o)
-			fmt.Fprintf(w, "\t%q -> %q", name, d.nodeName(o))
-			if i < len(p.outputs) {
-				fmt.Fprintf(w, " [label=%q]", p.outputs[i])
+// middlewareNames returns the names of the consumer middleware funcs.
+func (p *Proc) middlewareNames() []string {
+	ret := []string{}
+	for _, mw := range p.middlewares {
+		name := runtime.FuncForPC(reflect.ValueOf(mw).Pointer()).Name()
+		if i := strings.LastIndex(name, "/"); i >= 0 {
+			name = name[i+1:]
+		}
+		// strip closure suffixes like .func1
+		for {
+			i := strings.LastIndex(name, ".func")
+			if i < 0 {
+				break
 			}
-			fmt.Fprintln(w)
+			name = name[:i]
 		}
+		ret = append(ret, name)
 	}
+	return ret
 }
@@ -0,0 +1,146 @@
+package pipe_test
+
+import (
+	"testing"
+
+	"github.com/stdiopt/pipe"
+)
+
+func dumpLine() *pipe.Proc {
+	origin := pipe.NewProc(
+		pipe.WithName("origin"),
+		pipe.WithFunc(func(s pipe.Sender) error { return nil }),
+	)
+	split := pipe.NewProc(
+		pipe.WithName("split"),
+		pipe.WithOutputs("odds", "evens"),
+		pipe.WithWorkers(4),
+		pipe.WithSource(0, origin),
+		pipe.WithConsumerMiddleware(pipe.RetryConsumer(2)),
+		pipe.WithFunc(func(c pipe.Consumer, odds, evens pipe.Sender) error { return nil }),
+	)
+	pipe.NewProc(
+		pipe.WithBuffer(10),
+		pipe.WithNamedSource("odds", split),
+		pipe.WithNamedSource("evens", split),
+		pipe.WithFunc(func(c pipe.Consumer) error { return nil }),
+	)
+	pipe.NewProc(
+		pipe.WithNamedSource("evens", split),
+		pipe.WithFunc(func(c pipe.Consumer) error { return nil }),
+	)
+	return origin
+}
+
+func TestDump(t *testing.T) {
+	tests := []struct {
+		name string
+		dump func(p *pipe.Proc) string
+		want string
+	}{
+		{
+			name: "dot",
+			dump: pipe.DumpDOT,
+			want: `digraph {
+	node[shape=square, style="filled,rounded", width=1, color="#aaaaaa"]
+	"origin" -> "split"
+	"split" -> "unnamed#1" [label="odds"]
+	"split" -> "unnamed#1" [label="evens"]
+	"split" -> "unnamed#2" [label="evens"]
+	"origin"[shape=circle, fillcolor="#77ee77"]
+	"split"[ peripheries=3 label=<split<br/><br/><font point-size="8">workers: 4<br/>mw: pipe.RetryConsumer</font>>]
+	"unnamed#1"[shape=circle fillcolor="#aaaaff" label=<unnamed#1<br/><br/><font point-size="8">bufsize: 10</font>>]
+	"unnamed#2"[shape=circle fillcolor="#aaaaff"]
+}
+`,
+		},
+		{
+			name: "mermaid",
+			dump: pipe.DumpMermaid,
+			want: `graph LR
+	n0(("origin"))
+	n1["split<br/>workers: 4<br/>mw: pipe.RetryConsumer"]
+	n2(("unnamed#1<br/>bufsize: 10"))
+	n3(("unnamed#2"))
+	n0 --> n1
+	n1 -->|odds| n2
+	n1 -->|evens| n2
+	n1 -->|evens| n3
+`,
+		},
+		{
+			name: "json",
+			dump: pipe.DumpJSON,
+			want: `{
+  "nodes": [
+    {
+      "id": "origin",
+      "name": "origin",
+      "workers": 1,
+      "bufsize": 0
+    },
+    {
+      "id": "split",
+      "name": "split",
+      "outputs": [
+        "odds",
+        "evens"
+      ],
+      "workers": 4,
+      "bufsize": 0,
+      "middlewares": [
+        "pipe.RetryConsumer"
+      ]
+    },
+    {
+      "id": "unnamed#1",
+      "workers": 1,
+      "bufsize": 10,
+      "sink": true
+    },
+    {
+      "id": "unnamed#2",
+      "workers": 1,
+      "bufsize": 0,
+      "sink": true
+    }
+  ],
+  "edges": [
+    {
+      "from": "origin",
+      "to": "split",
+      "output": 0
+    },
+    {
+      "from": "split",
+      "to": "unnamed#1",
+      "output": 0,
+      "label": "odds"
+    },
+    {
+      "from": "split",
+      "to": "unnamed#1",
+      "output": 1,
+      "label": "evens"
+    },
+    {
+      "from": "split",
+      "to": "unnamed#2",
+      "output": 1,
+      "label": "evens"
+    }
+  ]
+}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// run a few times since map iteration order is random
+			for i := 0; i < 10; i++ {
+				if got := tt.dump(dumpLine()); got != tt.want {
+					t.Fatalf("\nwant: %v\n got: %v\n", tt.want, got)
+				}
+			}
+		})
+	}
+}
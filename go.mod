@@ -2,4 +2,7 @@ module github.com/stdiopt/pipe
 
 go 1.15
 
-require golang.org/x/sync v0.0.0-20201207232520-09787c993a3a
+require (
+	golang.org/x/sync v0.0.0-20201207232520-09787c993a3a
+	gopkg.in/yaml.v2 v2.4.0
+)
@@ -1,8 +1,8 @@
 package pipe
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"math"
 	"time"
 )
@@ -33,7 +33,12 @@ func RetryConsumer(tries int) ConsumerMiddleware {
 			var err error
 			for ; retry <= tries; retry++ {
 				if retry > 0 {
-					log.Printf("retrying: %v", m.Value())
+					logger, kv := loggerFrom(m.Context())
+					logger.Log(LevelWarn, "retrying", append(kv,
+						"origin", logProc(m.Origin()),
+						"retry", retry,
+						"err", err,
+					)...)
 				}
 				err = fn(m)
 				if err == nil {
@@ -61,8 +66,15 @@ func BackoffConsumer(max time.Duration, factor float64) ConsumerMiddleware {
 			if err == nil {
 				return nil
 			}
+			logger, kv := loggerFrom(m.Context())
 			t := b.forAttempt(1)
 			for tries := 1; t < b.max; tries++ {
+				logger.Log(LevelWarn, "retrying", append(kv,
+					"origin", logProc(m.Origin()),
+					"retry", tries,
+					"wait", t,
+					"err", err,
+				)...)
 				<-time.After(t)
 				err = fn(m)
 				if err == nil {
@@ -78,6 +90,50 @@ func BackoffConsumer(max time.Duration, factor float64) ConsumerMiddleware {
 	}
 }
 
+// TimeoutError is returned by TimeoutConsumer when the consumer func takes
+// longer than Timeout.
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("consumer timeout after %v", e.Timeout)
+}
+
+// Unwrap allows errors.Is(err, context.DeadlineExceeded).
+func (e *TimeoutError) Unwrap() error { return context.DeadlineExceeded }
+
+// TimeoutConsumer consumer middleware that gives each consumer call a
+// message context with a deadline of d and returns a *TimeoutError if the
+// call doesn't return in time, calls ignoring the message context are
+// abandoned and keep running in the background, with ConsumeBatch an
+// abandoned call only holds its own batch.
+func TimeoutConsumer(d time.Duration) ConsumerMiddleware {
+	return func(fn ConsumerFunc) ConsumerFunc {
+		return func(m Message) error {
+			ctx, cancel := context.WithTimeout(m.Context(), d)
+			defer cancel()
+
+			errc := make(chan error, 1)
+			go func() { errc <- fn(withContext(m, ctx)) }()
+			select {
+			case err := <-errc:
+				return err
+			case <-ctx.Done():
+				if err := m.Context().Err(); err != nil {
+					return err
+				}
+				logger, kv := loggerFrom(m.Context())
+				logger.Log(LevelWarn, "consumer timeout", append(kv,
+					"origin", logProc(m.Origin()),
+					"timeout", d,
+				)...)
+				return &TimeoutError{d}
+			}
+		}
+	}
+}
+
 type backoff struct {
 	max    time.Duration
 	factor float64
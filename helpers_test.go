@@ -0,0 +1,118 @@
+package pipe_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stdiopt/pipe"
+)
+
+func TestTimeoutConsumer(t *testing.T) {
+	tests := []struct {
+		name     string
+		mws      []pipe.ConsumerMiddleware
+		wantErr  error
+		wantCall int32
+	}{
+		{
+			name:     "timeout",
+			mws:      []pipe.ConsumerMiddleware{pipe.TimeoutConsumer(10 * time.Millisecond)},
+			wantErr:  context.DeadlineExceeded,
+			wantCall: 1,
+		},
+		{
+			name: "retry",
+			mws: []pipe.ConsumerMiddleware{
+				pipe.RetryConsumer(2),
+				pipe.TimeoutConsumer(10 * time.Millisecond),
+			},
+			wantCall: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origin := pipe.NewProc(
+				pipe.WithFunc(func(s pipe.Sender) error { return s.Send(1) }),
+			)
+			calls := int32(0)
+			pipe.NewProc(
+				pipe.WithSource(0, origin),
+				pipe.WithConsumerMiddleware(tt.mws...),
+				pipe.WithFunc(func(c pipe.Consumer) error {
+					return c.Consume(func(m pipe.Message) error {
+						// first call is stuck until the message deadline
+						if atomic.AddInt32(&calls, 1) == 1 {
+							<-m.Context().Done()
+							return m.Context().Err()
+						}
+						return nil
+					})
+				}),
+			)
+			err := origin.Run()
+			if want := tt.wantErr; !errors.Is(err, want) {
+				t.Errorf("\nwant: %v\n got: %v\n", want, err)
+			}
+			var terr *pipe.TimeoutError
+			if want := tt.wantErr != nil; errors.As(err, &terr) != want {
+				t.Errorf("expected a *pipe.TimeoutError, got: %T", err)
+			}
+			if want := tt.wantCall; atomic.LoadInt32(&calls) != want {
+				t.Errorf("\nwant: %v\n got: %v\n", want, calls)
+			}
+		})
+	}
+}
+
+// TestTimeoutConsumerAbandoned runs a typed consumer func while an abandoned
+// call of it is still running, run with -race.
+func TestTimeoutConsumerAbandoned(t *testing.T) {
+	origin := pipe.NewProc(
+		pipe.WithFunc(func(s pipe.Sender) error {
+			for i := 1; i <= 3; i++ {
+				if err := s.Send(i); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	)
+	release := make(chan struct{})
+	var mu sync.Mutex
+	res := []int{}
+	pipe.NewProc(
+		pipe.WithSource(0, origin),
+		pipe.WithConsumerMiddleware(
+			pipe.RetryConsumer(2),
+			pipe.TimeoutConsumer(10*time.Millisecond),
+		),
+		pipe.WithFunc(func(c pipe.Consumer) error {
+			return c.Consume(func(v int) error {
+				mu.Lock()
+				res = append(res, v)
+				first := len(res) == 1
+				mu.Unlock()
+				// first call ignores the deadline and is abandoned
+				if first {
+					<-release
+				}
+				return nil
+			})
+		}),
+	)
+	err := origin.Run()
+	close(release)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []int{1, 1, 2, 3}; !reflect.DeepEqual(res, want) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, res)
+	}
+}
@@ -0,0 +1,272 @@
+// Package join provides a proc that joins values from two sources by key.
+//
+// The join proc keeps the values of each side buffered so they can be
+// matched with values that arrive later on the other side, the buffer can be
+// bounded by time, by count and by a memory limit, values leaving the buffer
+// without a match are sent unpaired depending on the join Mode.
+//
+// The join state is kept per worker so join procs should run with a single
+// worker.
+package join
+
+import (
+	"container/list"
+	"time"
+
+	"github.com/stdiopt/pipe"
+)
+
+// Mode defines which values are sent by the join proc.
+type Mode int
+
+// Join modes
+const (
+	// Inner sends only matched pairs.
+	Inner Mode = iota
+	// Left sends matched pairs and left values that were never matched.
+	Left
+	// Outer sends matched pairs and values of both sides that were never
+	// matched.
+	Outer
+)
+
+// DefaultMaxBuffered is the default maximum number of values buffered.
+const DefaultMaxBuffered = 10000
+
+// Pair is sent by the join proc, Left or Right is nil on unmatched values.
+type Pair struct {
+	Key   interface{}
+	Left  interface{}
+	Right interface{}
+}
+
+// KeyFunc returns the key of a value, keys must be comparable.
+type KeyFunc func(v interface{}) interface{}
+
+// Option configures a join proc.
+type Option func(j *joiner)
+
+// WithMode sets the join mode, defaults to Inner.
+func WithMode(m Mode) Option {
+	return func(j *joiner) { j.mode = m }
+}
+
+// WithTimeWindow only matches values that arrived within d of each other.
+func WithTimeWindow(d time.Duration) Option {
+	return func(j *joiner) { j.window = d }
+}
+
+// WithCountWindow only matches values against the last n values of the other
+// side.
+func WithCountWindow(n int) Option {
+	return func(j *joiner) { j.count = n }
+}
+
+// WithMaxBuffered bounds the total number of buffered values, the oldest
+// values are evicted when the limit is reached.
+func WithMaxBuffered(n int) Option {
+	return func(j *joiner) { j.max = n }
+}
+
+// WithProcOptions passes options to the underlying proc.
+func WithProcOptions(opts ...pipe.ProcFunc) Option {
+	return func(j *joiner) { j.procOpts = append(j.procOpts, opts...) }
+}
+
+// New returns a proc that consumes output 0 of left and right and sends a
+// Pair for every left and right value with the same key.
+func New(left, right *pipe.Proc, leftKey, rightKey KeyFunc, opts ...Option) *pipe.Proc {
+	if left == right {
+		panic("join sources must be different procs")
+	}
+	j := &joiner{
+		left:     left,
+		right:    right,
+		leftKey:  leftKey,
+		rightKey: rightKey,
+		max:      DefaultMaxBuffered,
+	}
+	for _, fn := range opts {
+		fn(j)
+	}
+	return pipe.NewProc(append([]pipe.ProcFunc{
+		pipe.WithSource(0, left, right),
+		pipe.WithFunc(j.run),
+	}, j.procOpts...)...)
+}
+
+type joiner struct {
+	left, right       *pipe.Proc
+	leftKey, rightKey KeyFunc
+
+	mode     Mode
+	window   time.Duration
+	count    int
+	max      int
+	procOpts []pipe.ProcFunc
+}
+
+type entry struct {
+	key     interface{}
+	value   interface{}
+	at      time.Time
+	matched bool
+}
+
+// side holds the buffered values of one of the join inputs.
+type side struct {
+	entries *list.List
+	index   map[interface{}][]*list.Element
+	// emit unmatched values on eviction
+	emit bool
+}
+
+func newSide(emit bool) *side {
+	return &side{
+		entries: list.New(),
+		index:   map[interface{}][]*list.Element{},
+		emit:    emit,
+	}
+}
+
+func (s *side) push(e *entry) {
+	el := s.entries.PushBack(e)
+	s.index[e.key] = append(s.index[e.key], el)
+}
+
+// pop removes the oldest entry.
+func (s *side) pop() *entry {
+	el := s.entries.Front()
+	if el == nil {
+		return nil
+	}
+	s.entries.Remove(el)
+	e := el.Value.(*entry)
+	els := s.index[e.key]
+	for i, o := range els {
+		if o == el {
+			els = append(els[:i], els[i+1:]...)
+			break
+		}
+	}
+	if len(els) == 0 {
+		delete(s.index, e.key)
+	} else {
+		s.index[e.key] = els
+	}
+	return e
+}
+
+func (s *side) oldest() *entry {
+	if el := s.entries.Front(); el != nil {
+		return el.Value.(*entry)
+	}
+	return nil
+}
+
+type joinState struct {
+	left, right *side
+	out         pipe.Sender
+}
+
+func (j *joiner) run(c pipe.Consumer, out pipe.Sender) error {
+	s := &joinState{
+		left:  newSide(j.mode == Left || j.mode == Outer),
+		right: newSide(j.mode == Outer),
+		out:   out,
+	}
+	err := c.Consume(func(m pipe.Message) error {
+		now := time.Now()
+		if err := j.expire(s, now); err != nil {
+			return err
+		}
+
+		var this, other *side
+		var key interface{}
+		// origins are compared with Is so cloned joins match the copies
+		switch origin := m.Origin(); {
+		case origin.Is(j.left):
+			this, other, key = s.left, s.right, j.leftKey(m.Value())
+		case origin.Is(j.right):
+			this, other, key = s.right, s.left, j.rightKey(m.Value())
+		default:
+			return nil
+		}
+
+		e := &entry{key: key, value: m.Value(), at: now}
+		for _, el := range other.index[key] {
+			o := el.Value.(*entry)
+			o.matched, e.matched = true, true
+			p := Pair{Key: key, Left: e.value, Right: o.value}
+			if this == s.right {
+				p.Left, p.Right = o.value, e.value
+			}
+			if err := out.Send(p); err != nil {
+				return err
+			}
+		}
+		this.push(e)
+		return j.evict(s, this)
+	})
+	if err != nil {
+		return err
+	}
+	// input is closed, remaining values will never be matched
+	for _, sd := range []*side{s.left, s.right} {
+		for sd.entries.Len() > 0 {
+			if err := s.unmatched(sd, sd.pop()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// expire removes values that are older than the time window.
+func (j *joiner) expire(s *joinState, now time.Time) error {
+	if j.window <= 0 {
+		return nil
+	}
+	for _, sd := range []*side{s.left, s.right} {
+		for e := sd.oldest(); e != nil && now.Sub(e.at) > j.window; e = sd.oldest() {
+			if err := s.unmatched(sd, sd.pop()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// evict enforces the count window on sd and the memory limit on both sides.
+func (j *joiner) evict(s *joinState, sd *side) error {
+	for j.count > 0 && sd.entries.Len() > j.count {
+		if err := s.unmatched(sd, sd.pop()); err != nil {
+			return err
+		}
+	}
+	for j.max > 0 && s.left.entries.Len()+s.right.entries.Len() > j.max {
+		// evict from the side holding the oldest value
+		victim := s.left
+		l, r := s.left.oldest(), s.right.oldest()
+		if l == nil || (r != nil && r.at.Before(l.at)) {
+			victim = s.right
+		}
+		if err := s.unmatched(victim, victim.pop()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *joinState) unmatched(sd *side, e *entry) error {
+	if e.matched || !sd.emit {
+		return nil
+	}
+	p := Pair{Key: e.key}
+	if sd == s.left {
+		p.Left = e.value
+	} else {
+		p.Right = e.value
+	}
+	return s.out.Send(p)
+}
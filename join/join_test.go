@@ -0,0 +1,135 @@
+package join_test
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/stdiopt/pipe"
+	"github.com/stdiopt/pipe/join"
+)
+
+type user struct {
+	id   int
+	name string
+}
+
+type order struct {
+	user int
+	item string
+}
+
+func TestJoin(t *testing.T) {
+	users := []user{{1, "alice"}, {2, "bob"}, {3, "carol"}}
+	orders := []order{{1, "book"}, {1, "pen"}, {3, "cup"}, {4, "hat"}}
+
+	tests := []struct {
+		name    string
+		mode    join.Mode
+		wantRes []string
+	}{
+		{
+			name: "inner",
+			mode: join.Inner,
+			wantRes: []string{
+				"1 alice book",
+				"1 alice pen",
+				"3 carol cup",
+			},
+		},
+		{
+			name: "left",
+			mode: join.Left,
+			wantRes: []string{
+				"1 alice book",
+				"1 alice pen",
+				"2 bob <nil>",
+				"3 carol cup",
+			},
+		},
+		{
+			name: "outer",
+			mode: join.Outer,
+			wantRes: []string{
+				"1 alice book",
+				"1 alice pen",
+				"2 bob <nil>",
+				"3 carol cup",
+				"4 <nil> hat",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origin := pipe.NewProc(
+				pipe.WithFunc(func(s pipe.Sender) error {
+					return s.Send(nil)
+				}),
+			)
+			left := pipe.NewProc(
+				pipe.WithSource(0, origin),
+				pipe.WithFunc(func(c pipe.Consumer, s pipe.Sender) error {
+					for _, u := range users {
+						if err := s.Send(u); err != nil {
+							return err
+						}
+					}
+					return c.Consume(func(interface{}) error { return nil })
+				}),
+			)
+			right := pipe.NewProc(
+				pipe.WithSource(0, origin),
+				pipe.WithFunc(func(c pipe.Consumer, s pipe.Sender) error {
+					for _, o := range orders {
+						if err := s.Send(o); err != nil {
+							return err
+						}
+					}
+					return c.Consume(func(interface{}) error { return nil })
+				}),
+			)
+			j := join.New(left, right,
+				func(v interface{}) interface{} { return v.(user).id },
+				func(v interface{}) interface{} { return v.(order).user },
+				join.WithMode(tt.mode),
+			)
+
+			res := []string{}
+			pipe.NewProc(
+				pipe.WithSource(0, j),
+				pipe.WithFunc(func(c pipe.Consumer) error {
+					return c.Consume(func(p join.Pair) error {
+						var name, item interface{}
+						if u, ok := p.Left.(user); ok {
+							name = u.name
+						}
+						if o, ok := p.Right.(order); ok {
+							item = o.item
+						}
+						res = append(res, fmt.Sprint(p.Key, " ", name, " ", item))
+						return nil
+					})
+				}),
+			)
+
+			if err := origin.Run(); err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(res)
+			if want := tt.wantRes; !reflect.DeepEqual(res, want) {
+				t.Errorf("\nwant: %v\n got: %v\n", want, res)
+			}
+
+			// the join func resolves the cloned sources
+			res = res[:0]
+			if err := pipe.Clone(origin).Run(); err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(res)
+			if want := tt.wantRes; !reflect.DeepEqual(res, want) {
+				t.Errorf("\nwant: %v\n got: %v\n", want, res)
+			}
+		})
+	}
+}
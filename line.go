@@ -4,7 +4,11 @@ import (
 	"context"
 	"errors"
 	"reflect"
+	"runtime/pprof"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 )
@@ -14,126 +18,457 @@ import (
 type Message interface {
 	Origin() *Proc
 	Value() interface{}
+	// Context returns the context of the consumer receiving the message
+	Context() context.Context
 }
 
 type message struct {
 	origin *Proc
 	value  interface{}
+	ctx    context.Context
+	// acks are the acks of the messages this one derives from
+	acks acks
 }
 
 func (m message) Origin() *Proc      { return m.origin }
 func (m message) Value() interface{} { return m.value }
 
-type line struct {
-	sync.Mutex
+func (m message) Context() context.Context {
+	if m.ctx == nil {
+		return context.Background()
+	}
+	return m.ctx
+}
 
-	eg  *errgroup.Group
+// ctxMessage overrides the context of a Message
+type ctxMessage struct {
+	Message
 	ctx context.Context
+}
+
+func (m ctxMessage) Context() context.Context { return m.ctx }
+
+// withContext returns a copy of m with ctx as context.
+func withContext(m Message, ctx context.Context) Message {
+	switch mm := m.(type) {
+	case message:
+		mm.ctx = ctx
+		return mm
+	case ctxMessage:
+		mm.ctx = ctx
+		return mm
+	}
+	return ctxMessage{m, ctx}
+}
+
+// RunOption configures a line started by Run, RunWithContext or Start.
+type RunOption func(l *Line)
+
+// WithLineLogger sets the logger for all procs of the line that don't have
+// their own logger.
+func WithLineLogger(lg Logger) RunOption {
+	return func(l *Line) { l.logger = lg }
+}
+
+// Line is a running set of procs started by Proc.Start.
+type Line struct {
+	mu sync.Mutex
 
-	procs map[*Proc]chan Message
+	id int64
+
+	eg      *errgroup.Group
+	ctx     context.Context
+	logger  Logger
+	root    *Proc
+	started time.Time
+
+	errs     errorHistory
+	sampling *sampling
+
+	nodes map[*Proc]*node
+	order []*node
 	chans map[chan Message]int
 }
 
-func runLine(ctx context.Context, p *Proc) error {
-	g, ctx := errgroup.WithContext(ctx)
-	l := line{
-		eg:    g,
-		ctx:   ctx,
-		procs: map[*Proc]chan Message{},
-		chans: map[chan Message]int{},
+// node is the runtime state of a proc in a line
+type node struct {
+	// counters are kept first for 64bit alignment
+	received int64
+	errors   int64
+	skipped  int64
+
+	proc    *Proc
+	inputs  []*input
+	senders []sender
+
+	// fn is the proc func, it differs from the proc one once replaced
+	fn     interface{}
+	logger Logger
+
+	running int32
+	states  []int32
+	// live is the number of workers that didn't exit, guarded by the line
+	// lock as it's the count each output channel holds for the node
+	live     int
+	gen      *generation
+	done     chan struct{}
+	stopOnce sync.Once
+
+	// rate samples of the received counter, guarded by the line lock
+	prevRate rateSample
+	lastRate rateSample
+
+	// paused is closed when the node is paused, resume is not nil while
+	// the node is paused and closed on resume
+	pauseMu sync.Mutex
+	paused  chan struct{}
+	resume  chan struct{}
+}
+
+// generation is a set of workers started together, Replace drains the
+// current generation and hands its inputs to the next one.
+type generation struct {
+	drain chan struct{}
+	wg    sync.WaitGroup
+}
+
+func (g *generation) draining() bool {
+	select {
+	case <-g.drain:
+		return true
+	default:
+		return false
 	}
+}
 
-	l.get(p, 1)
+type nodeCtxKey struct{}
 
-	return g.Wait()
+// nodeFromContext returns the node of the proc consuming with ctx.
+func nodeFromContext(ctx context.Context) *node {
+	n, _ := ctx.Value(nodeCtxKey{}).(*node)
+	return n
 }
 
-func (l *line) add(n int, chs ...chan Message) {
-	l.Lock()
-	defer l.Unlock()
+// sender returns the sender for output k, k can be an int or an output name.
+func (n *node) sender(k interface{}) (sender, bool) {
+	i := -1
+	switch v := k.(type) {
+	case int:
+		i = v
+	case string:
+		i = n.proc.namedOutput(v)
+	}
+	if i < 0 || i >= len(n.senders) {
+		return sender{}, false
+	}
+	return n.senders[i], true
+}
 
-	for _, ch := range chs {
-		v := l.chans[ch] + n
-		if v == 0 {
-			close(ch)
-			delete(l.chans, ch)
-			continue
-		}
-		l.chans[ch] = v
+// consumes returns true if the node func takes a Consumer.
+func (n *node) consumes() bool {
+	return reflect.TypeOf(n.fn).In(0) == consumerTyp
+}
+
+// pause makes the consumers wait before receiving the next message.
+func (n *node) pause() {
+	n.pauseMu.Lock()
+	defer n.pauseMu.Unlock()
+	if n.resume == nil {
+		n.resume = make(chan struct{})
+		close(n.paused)
 	}
 }
 
-// get will get or start a proc and return an output chan to that proc.
-func (l *line) get(p *Proc, n int) chan Message {
-	if ch, ok := l.procs[p]; ok {
-		l.add(n, ch)
-		return ch
+func (n *node) unpause() {
+	n.pauseMu.Lock()
+	defer n.pauseMu.Unlock()
+	if n.resume != nil {
+		close(n.resume)
+		n.resume = nil
+		n.paused = make(chan struct{})
 	}
-	ch := make(chan Message, p.bufsize)
-	l.add(n, ch)
+}
+
+func (n *node) isPaused() bool {
+	_, resume := n.pauseState()
+	return resume != nil
+}
 
-	l.procs[p] = ch
+// pauseState returns a channel closed when the node is paused and one closed
+// when it resumes, resume is nil if the node isn't paused.
+func (n *node) pauseState() (paused, resume <-chan struct{}) {
+	n.pauseMu.Lock()
+	defer n.pauseMu.Unlock()
+	return n.paused, n.resume
+}
 
-	fnVal := reflect.ValueOf(p.fn)
-	fnTyp := fnVal.Type()
+// stop closes done so senders stop sending to this node.
+func (n *node) stop() {
+	n.stopOnce.Do(func() { close(n.done) })
+}
+
+// input is a link between a proc output and a consumer
+type input struct {
+	sent    int64
+	blocked int32
+
+	origin *Proc
+	output int
+	ch     chan Message
+	// done is closed when the consumer proc stops
+	done <-chan struct{}
+	// samples is nil unless the line runs WithSampling
+	samples *samples
+
+	// mu is held by senders while sending so Detach can wait for them
+	mu         sync.RWMutex
+	detached   bool
+	detach     chan struct{}
+	detachOnce sync.Once
+}
+
+// lineID is the last line id used in pprof labels.
+var lineID int64
+
+func startLine(ctx context.Context, p *Proc, opts ...RunOption) *Line {
+	g, ctx := errgroup.WithContext(ctx)
+	l := &Line{
+		id:      atomic.AddInt64(&lineID, 1),
+		eg:      g,
+		ctx:     ctx,
+		logger:  defaultLogger,
+		root:    p,
+		started: time.Now(),
+		errs:    errorHistory{size: 32},
+		nodes:   map[*Proc]*node{},
+		chans:   map[chan Message]int{},
+	}
+	for _, fn := range opts {
+		fn(l)
+	}
+
+	// channels are all created and counted before any worker starts so a
+	// finishing worker can't close a channel that is still being linked
+	l.build(p)
+	for _, n := range l.order {
+		l.start(n, nil)
+	}
+	return l
+}
+
+// ID returns the line id, set in the pprof labels of the workers.
+func (l *Line) ID() int64 { return l.id }
+
+// Wait blocks until every proc of the line finishes and returns the first
+// error.
+func (l *Line) Wait() error {
+	return l.eg.Wait()
+}
+
+// count adds n to the number of workers sending to in, the channel is closed
+// when no worker sends to it anymore, l must be locked.
+func (l *Line) count(n int, in *input) {
+	v := l.chans[in.ch] + n
+	if v == 0 {
+		close(in.ch)
+		delete(l.chans, in.ch)
+		return
+	}
+	l.chans[in.ch] = v
+}
 
-	nworkers := p.nworkers
-	if nworkers <= 0 {
-		nworkers = 1
+// build walks the graph from p creating a node for each proc and an input
+// channel for each link.
+func (l *Line) build(p *Proc) *node {
+	if n, ok := l.nodes[p]; ok {
+		return n
+	}
+	// composites are flattened, links to them are resolved to their inputs
+	if p.sub != nil {
+		for _, in := range p.sub.inputs {
+			l.build(in)
+		}
+		return nil
 	}
+	n := &node{
+		proc:   p,
+		fn:     p.fn,
+		logger: l.logger,
+		done:   make(chan struct{}),
+		paused: make(chan struct{}),
+	}
+	if p.logger != nil {
+		n.logger = p.logger
+	}
+	l.nodes[p] = n
+	l.order = append(l.order, n)
+
+	fnTyp := reflect.TypeOf(p.fn)
+	nworkers := p.workers()
 
 	// Senders are shared across workers
-	senders := []sender{}
 	nsenders := fnTyp.NumIn()
 	if fnTyp.In(0) == consumerTyp {
 		nsenders--
 	}
 	for i := 0; i < nsenders; i++ {
+		s := sender{
+			ctx:    l.ctx,
+			origin: p,
+			outs:   &outputList{},
+		}
 		// get Indexed outputs
-		outputs := []chan Message{}
-		for _, t := range p.getOutputs(i) {
-			outputs = append(outputs, l.get(t, nworkers))
+		for _, lk := range p.links(i) {
+			in := l.input(lk)
+			l.chans[in.ch] += nworkers
+			s.outs.add(in)
 		}
-		s := sender{
-			ctx:     l.ctx,
-			origin:  p,
-			outputs: outputs,
+		n.senders = append(n.senders, s)
+	}
+	return n
+}
+
+// input builds the link target and returns its input for the link.
+func (l *Line) input(lk link) *input {
+	in := l.build(lk.target).input(lk.origin, lk.output)
+	if l.sampling != nil && in.samples == nil {
+		in.samples = &samples{
+			every: l.sampling.every,
+			list:  make([]Sample, 0, l.sampling.size),
 		}
-		senders = append(senders, s)
 	}
+	return in
+}
 
-	args := make([]reflect.Value, 0, fnTyp.NumIn())
-	if fnTyp.In(0) == consumerTyp {
-		c := &consumer{
-			ctx:        l.ctx,
-			input:      ch,
-			middleware: p.consumerMiddleware,
+// input returns the input linked to the origin output, creating it if
+// necessary.
+func (n *node) input(origin *Proc, output int) *input {
+	for _, in := range n.inputs {
+		if in.origin == origin && in.output == output {
+			return in
 		}
-		args = append(args, reflect.ValueOf(c))
 	}
-	for _, s := range senders {
-		args = append(args, reflect.ValueOf(s))
+	in := &input{
+		origin: origin,
+		output: output,
+		ch:     make(chan Message, n.proc.bufsize),
+		done:   n.done,
+		detach: make(chan struct{}),
+	}
+	n.inputs = append(n.inputs, in)
+	return in
+}
+
+// start runs the proc workers as a new generation, if prev is not nil the
+// new workers replace the live workers of prev once they are drained.
+func (l *Line) start(n *node, prev *generation) {
+	p := n.proc
+	fnVal := reflect.ValueOf(n.fn)
+	fnTyp := fnVal.Type()
+
+	// consumer context carries the node so middlewares can reach it
+	ctx := context.WithValue(l.ctx, nodeCtxKey{}, n)
+
+	slots := []int{}
+	if prev == nil {
+		n.running = int32(p.workers())
+		n.live = p.workers()
+		n.states = make([]int32, p.workers())
+	}
+	for i := range n.states {
+		if WorkerState(atomic.LoadInt32(&n.states[i])) != WorkerDone {
+			slots = append(slots, i)
+		}
 	}
+	gen := &generation{drain: make(chan struct{})}
+	gen.wg.Add(len(slots))
+	n.gen = gen
 
-	for i := 0; i < nworkers; i++ {
+	for _, i := range slots {
+		state := &n.states[i]
+		args := make([]reflect.Value, 0, fnTyp.NumIn())
+		var c *consumer
+		if fnTyp.In(0) == consumerTyp {
+			c = &consumer{
+				inputs:     n.inputs,
+				middleware: p.consumerMiddleware,
+				done:       n.done,
+				stop:       n.stop,
+				drain:      gen.drain,
+				limiter:    p.limiter,
+				node:       n,
+				state:      state,
+				onErr: func(err error, m Message) {
+					var origin *Proc
+					if m != nil {
+						origin = m.Origin()
+					}
+					l.errs.add(p, origin, err)
+				},
+			}
+			// the worker context lets Ack find the worker of a message
+			c.ctx = context.WithValue(ctx, workerCtxKey{}, c)
+			args = append(args, reflect.ValueOf(c))
+		}
+		for _, s := range n.senders {
+			// messages sent by the worker derive from the ones it consumes
+			s.worker = c
+			args = append(args, reflect.ValueOf(s))
+		}
+
+		labels := pprof.Labels(
+			"line", strconv.FormatInt(l.id, 10),
+			"proc", procLabel(p),
+			"worker", strconv.Itoa(i),
+		)
 		l.eg.Go(func() error {
-			defer func() {
-				for _, s := range senders {
-					l.add(-1, s.outputs...)
-				}
-			}()
+			defer gen.wg.Done()
+			if prev != nil {
+				prev.wg.Wait()
+			}
+			defer l.exit(n, gen, state)
 
-			ret := fnVal.Call(args)
+			var ret []reflect.Value
+			// workers run with labels so profiles and goroutine dumps can
+			// be filtered per proc
+			pprof.Do(ctx, labels, func(context.Context) {
+				ret = fnVal.Call(args)
+			})
 			if len(ret) > 0 {
-				if err, ok := ret[0].Interface().(error); ok && err != nil {
+				if err, ok := ret[0].Interface().(error); ok && err != nil && !errors.Is(err, ErrStop) {
+					atomic.AddInt64(&n.errors, 1)
+					// consume callback errors are already recorded
+					if c == nil || !c.recorded(err) {
+						l.errs.add(p, nil, err)
+					}
 					return err
 				}
 			}
 			return nil
 		})
 	}
+}
 
-	return ch
+// exit releases the worker outputs, the last worker to exit stops the node,
+// drained workers hand everything to their replacements.
+func (l *Line) exit(n *node, gen *generation, state *int32) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if gen.draining() {
+		return
+	}
+	atomic.StoreInt32(state, int32(WorkerDone))
+	for _, s := range n.senders {
+		for _, in := range s.outs.get() {
+			l.count(-1, in)
+		}
+	}
+	atomic.AddInt32(&n.running, -1)
+	n.live--
+	// nothing will consume the inputs anymore
+	if n.live == 0 {
+		n.stop()
+	}
 }
 
 var (
@@ -0,0 +1,148 @@
+package pipe
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Level is the severity of a log entry.
+type Level int
+
+// Log levels
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+// Logger is used by lines and the built-in middlewares, kv are alternating
+// key value pairs.
+type Logger interface {
+	Log(level Level, msg string, kv ...interface{})
+}
+
+// LoggerFunc is a func that implements Logger.
+type LoggerFunc func(level Level, msg string, kv ...interface{})
+
+// Log implements Logger.
+func (fn LoggerFunc) Log(level Level, msg string, kv ...interface{}) {
+	fn(level, msg, kv...)
+}
+
+// StdLogger returns a Logger that writes to l as `LEVEL msg key=value`, a
+// nil l writes to the standard logger.
+func StdLogger(l *log.Logger) Logger {
+	return LoggerFunc(func(level Level, msg string, kv ...interface{}) {
+		b := &strings.Builder{}
+		fmt.Fprintf(b, "%s %s", level, msg)
+		for i := 0; i < len(kv); i += 2 {
+			if i+1 < len(kv) {
+				fmt.Fprintf(b, " %v=%v", kv[i], kv[i+1])
+				continue
+			}
+			fmt.Fprintf(b, " %v", kv[i])
+		}
+		if l == nil {
+			log.Print(b.String())
+			return
+		}
+		l.Print(b.String())
+	})
+}
+
+// KVLogger is a leveled key value logger like *slog.Logger.
+type KVLogger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// LoggerFromKV adapts a KVLogger to a Logger.
+func LoggerFromKV(l KVLogger) Logger {
+	return LoggerFunc(func(level Level, msg string, kv ...interface{}) {
+		switch level {
+		case LevelDebug:
+			l.Debug(msg, kv...)
+		case LevelInfo:
+			l.Info(msg, kv...)
+		case LevelWarn:
+			l.Warn(msg, kv...)
+		default:
+			l.Error(msg, kv...)
+		}
+	})
+}
+
+// NopLogger discards every log entry.
+var NopLogger Logger = LoggerFunc(func(Level, string, ...interface{}) {})
+
+var defaultLogger = StdLogger(nil)
+
+// loggerFrom returns the logger of the proc consuming with ctx.
+func loggerFrom(ctx context.Context) (Logger, []interface{}) {
+	n := nodeFromContext(ctx)
+	if n == nil {
+		return defaultLogger, nil
+	}
+	return n.logger, []interface{}{"proc", logProc(n.proc)}
+}
+
+// logProc returns the proc as logged, structured loggers would encode the
+// *Proc fields instead of its name.
+func logProc(p *Proc) string {
+	if p == nil {
+		return "<nil>"
+	}
+	return p.String()
+}
+
+// LoggingConsumer consumer middleware that logs the start, finish and error
+// of each message with the consuming proc, origin and duration, redact
+// transforms the logged value, if nil values are not logged, RedactType can
+// be used to log only the value type.
+func LoggingConsumer(redact func(v interface{}) interface{}) ConsumerMiddleware {
+	return func(fn ConsumerFunc) ConsumerFunc {
+		return func(m Message) error {
+			logger, kv := loggerFrom(m.Context())
+			kv = append(kv, "origin", logProc(m.Origin()))
+			if redact != nil {
+				kv = append(kv, "value", redact(m.Value()))
+			}
+			logger.Log(LevelDebug, "consume start", kv...)
+
+			mark := time.Now()
+			err := fn(m)
+			kv = append(kv, "duration", time.Since(mark))
+			if err != nil {
+				logger.Log(LevelError, "consume error", append(kv, "err", err)...)
+				return err
+			}
+			logger.Log(LevelDebug, "consume finish", kv...)
+			return nil
+		}
+	}
+}
+
+// RedactType replaces a value with its type name.
+func RedactType(v interface{}) interface{} {
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,179 @@
+package pipe_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stdiopt/pipe"
+)
+
+type logRecorder struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (r *logRecorder) Log(level pipe.Level, msg string, kv ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := []string{}
+	for i := 0; i < len(kv); i += 2 {
+		keys = append(keys, fmt.Sprint(kv[i]))
+	}
+	r.entries = append(r.entries, fmt.Sprintf("%s %s %s", level, msg, strings.Join(keys, ",")))
+}
+
+func TestLogger(t *testing.T) {
+	newLine := func(procOpts ...pipe.ProcFunc) *pipe.Proc {
+		origin := pipe.NewProc(
+			pipe.WithName("origin"),
+			pipe.WithFunc(func(s pipe.Sender) error { return s.Send("secret") }),
+		)
+		calls := 0
+		pipe.NewProc(append([]pipe.ProcFunc{
+			pipe.WithName("consumer"),
+			pipe.WithSource(0, origin),
+			pipe.WithConsumerMiddleware(
+				pipe.LoggingConsumer(pipe.RedactType),
+				pipe.RetryConsumer(1),
+			),
+			pipe.WithFunc(func(c pipe.Consumer) error {
+				return c.Consume(func(string) error {
+					calls++
+					if calls == 1 {
+						return errors.New("fail")
+					}
+					return nil
+				})
+			}),
+		}, procOpts...)...)
+		return origin
+	}
+
+	want := []string{
+		"DEBUG consume start proc,origin,value",
+		"WARN retrying proc,origin,retry,err",
+		"DEBUG consume finish proc,origin,value,duration",
+	}
+
+	t.Run("line logger", func(t *testing.T) {
+		rec := &logRecorder{}
+		if err := newLine().Run(pipe.WithLineLogger(rec)); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(rec.entries, want) {
+			t.Errorf("\nwant: %v\n got: %v\n", want, rec.entries)
+		}
+	})
+
+	t.Run("proc logger", func(t *testing.T) {
+		lineRec, procRec := &logRecorder{}, &logRecorder{}
+		origin := newLine(pipe.WithLogger(procRec))
+		if err := origin.Run(pipe.WithLineLogger(lineRec)); err != nil {
+			t.Fatal(err)
+		}
+		if len(lineRec.entries) != 0 {
+			t.Errorf("unexpected line log entries: %v", lineRec.entries)
+		}
+		if !reflect.DeepEqual(procRec.entries, want) {
+			t.Errorf("\nwant: %v\n got: %v\n", want, procRec.entries)
+		}
+	})
+}
+
+type kvRecorder struct{ entries []string }
+
+func (r *kvRecorder) record(level, msg string, args ...interface{}) {
+	r.entries = append(r.entries, fmt.Sprint(level, " ", msg, " ", args))
+}
+
+func (r *kvRecorder) Debug(msg string, args ...interface{}) { r.record("debug", msg, args...) }
+func (r *kvRecorder) Info(msg string, args ...interface{})  { r.record("info", msg, args...) }
+func (r *kvRecorder) Warn(msg string, args ...interface{})  { r.record("warn", msg, args...) }
+func (r *kvRecorder) Error(msg string, args ...interface{}) { r.record("error", msg, args...) }
+
+func TestLoggerFromKV(t *testing.T) {
+	rec := &kvRecorder{}
+	l := pipe.LoggerFromKV(rec)
+	l.Log(pipe.LevelDebug, "a", "k", 1)
+	l.Log(pipe.LevelInfo, "b")
+	l.Log(pipe.LevelWarn, "c", "k", 2)
+	l.Log(pipe.LevelError, "d", "k", 3)
+
+	want := []string{
+		"debug a [k 1]",
+		"info b []",
+		"warn c [k 2]",
+		"error d [k 3]",
+	}
+	if !reflect.DeepEqual(rec.entries, want) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, rec.entries)
+	}
+}
+
+// jsonKVRecorder encodes the key values as JSON like slog.JSONHandler,
+// errors are encoded with their message.
+type jsonKVRecorder struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (r *jsonKVRecorder) record(msg string, args ...interface{}) {
+	m := map[string]interface{}{"msg": msg}
+	for i := 0; i+1 < len(args); i += 2 {
+		v := args[i+1]
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		m[fmt.Sprint(args[i])] = v
+	}
+	b := &strings.Builder{}
+	enc := json.NewEncoder(b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(m); err != nil {
+		b.WriteString(err.Error())
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, strings.TrimSpace(b.String()))
+}
+
+func (r *jsonKVRecorder) Debug(msg string, args ...interface{}) { r.record(msg, args...) }
+func (r *jsonKVRecorder) Info(msg string, args ...interface{})  { r.record(msg, args...) }
+func (r *jsonKVRecorder) Warn(msg string, args ...interface{})  { r.record(msg, args...) }
+func (r *jsonKVRecorder) Error(msg string, args ...interface{}) { r.record(msg, args...) }
+
+func TestLoggerFromKVEncoding(t *testing.T) {
+	origin := pipe.NewProc(
+		pipe.WithName("origin"),
+		pipe.WithFunc(func(s pipe.Sender) error { return s.Send(1) }),
+	)
+	calls := 0
+	pipe.NewProc(
+		pipe.WithName("consumer"),
+		pipe.WithSource(0, origin),
+		pipe.WithConsumerMiddleware(pipe.RetryConsumer(1)),
+		pipe.WithFunc(func(c pipe.Consumer) error {
+			return c.Consume(func(int) error {
+				if calls++; calls == 1 {
+					return errors.New("fail")
+				}
+				return nil
+			})
+		}),
+	)
+	rec := &jsonKVRecorder{}
+	if err := origin.Run(pipe.WithLineLogger(pipe.LoggerFromKV(rec))); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`{"err":"fail","msg":"retrying","origin":"<origin>","proc":"<consumer>","retry":1}`,
+	}
+	if !reflect.DeepEqual(rec.entries, want) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, rec.entries)
+	}
+}
@@ -0,0 +1,69 @@
+package op
+
+import "github.com/stdiopt/pipe"
+
+// Zip returns a proc that consumes output 0 of each source and sends a
+// []interface{} with the i-th value of every source in the sources order, it
+// stops zipping when any of the sources closes.
+func Zip(sources []*pipe.Proc, opts ...pipe.ProcFunc) *pipe.Proc {
+	return newProc(func(c pipe.Consumer, out pipe.Sender) error {
+		inputs, err := sourceInputs(c, sources)
+		if err != nil {
+			return err
+		}
+		for {
+			ms := make([]pipe.Message, 0, len(inputs))
+			vs := make([]interface{}, len(inputs))
+			for i, in := range inputs {
+				m, ok := in.Recv()
+				if !ok {
+					return drain(c)
+				}
+				ms = append(ms, m)
+				vs[i] = m.Value()
+			}
+			err := out.Send(vs)
+			for _, m := range ms {
+				pipe.Ack(m, err)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}, opts, pipe.WithSource(0, sources...))
+}
+
+// MergeSorted returns a proc that consumes output 0 of each source, which
+// must be sorted by less, and sends all values in order.
+func MergeSorted(less func(a, b interface{}) bool, sources []*pipe.Proc, opts ...pipe.ProcFunc) *pipe.Proc {
+	return newProc(func(c pipe.Consumer, out pipe.Sender) error {
+		inputs, err := sourceInputs(c, sources)
+		if err != nil {
+			return err
+		}
+		heads := make([]pipe.Message, len(inputs))
+		for i, in := range inputs {
+			heads[i], _ = in.Recv()
+		}
+		for {
+			min := -1
+			for i, h := range heads {
+				if h == nil {
+					continue
+				}
+				if min == -1 || less(h.Value(), heads[min].Value()) {
+					min = i
+				}
+			}
+			if min == -1 {
+				return nil
+			}
+			err := out.Send(heads[min].Value())
+			pipe.Ack(heads[min], err)
+			if err != nil {
+				return err
+			}
+			heads[min], _ = inputs[min].Recv()
+		}
+	}, opts, pipe.WithSource(0, sources...))
+}
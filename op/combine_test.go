@@ -0,0 +1,97 @@
+package op_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stdiopt/pipe"
+	"github.com/stdiopt/pipe/op"
+)
+
+// values returns a proc linked to origin that sends vs.
+func values(origin *pipe.Proc, vs ...interface{}) *pipe.Proc {
+	return pipe.NewProc(
+		pipe.WithSource(0, origin),
+		pipe.WithFunc(func(c pipe.Consumer, s pipe.Sender) error {
+			if err := c.Consume(func(interface{}) error { return nil }); err != nil {
+				return err
+			}
+			for _, v := range vs {
+				if err := s.Send(v); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	)
+}
+
+func start() *pipe.Proc {
+	return pipe.NewProc(
+		pipe.WithFunc(func(s pipe.Sender) error { return s.Send(nil) }),
+	)
+}
+
+func collect(source *pipe.Proc, res *[]interface{}) {
+	pipe.NewProc(
+		pipe.WithSource(0, source),
+		pipe.WithFunc(func(c pipe.Consumer) error {
+			return c.Consume(func(v interface{}) error {
+				*res = append(*res, v)
+				return nil
+			})
+		}),
+	)
+}
+
+func TestZip(t *testing.T) {
+	origin := start()
+	a := values(origin, 1, 2, 3)
+	b := values(origin, "a", "b", "c", "d")
+
+	res := []interface{}{}
+	collect(op.Zip([]*pipe.Proc{a, b}), &res)
+
+	if err := origin.Run(); err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{
+		[]interface{}{1, "a"},
+		[]interface{}{2, "b"},
+		[]interface{}{3, "c"},
+	}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, res)
+	}
+
+	// the zip func resolves the cloned sources
+	res = res[:0]
+	if err := pipe.Clone(origin).Run(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, res)
+	}
+}
+
+func TestMergeSorted(t *testing.T) {
+	origin := start()
+	a := values(origin, 1, 4, 7, 10)
+	b := values(origin, 2, 5, 8)
+	c := values(origin, 3, 6, 9, 11, 12)
+
+	res := []interface{}{}
+	collect(op.MergeSorted(
+		func(a, b interface{}) bool { return a.(int) < b.(int) },
+		[]*pipe.Proc{a, b, c},
+		pipe.WithBuffer(1),
+	), &res)
+
+	if err := origin.Run(); err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, res)
+	}
+}
@@ -0,0 +1,36 @@
+package op
+
+import (
+	"fmt"
+	"reflect"
+)
+
+var errTyp = reflect.TypeOf((*error)(nil)).Elem()
+
+// callFunc validates that fn is a func with nin params and returns nout
+// values plus an error, the returned func calls fn with the args.
+func callFunc(sig string, fn interface{}, nin, nout int) func(args ...interface{}) ([]reflect.Value, error) {
+	fnVal := reflect.ValueOf(fn)
+	fnTyp := fnVal.Type()
+	if fnTyp.Kind() != reflect.Func ||
+		fnTyp.NumIn() != nin ||
+		fnTyp.NumOut() != nout+1 ||
+		!fnTyp.Out(nout).Implements(errTyp) {
+		panic(fmt.Sprintf("param should be '%s'", sig))
+	}
+	return func(args ...interface{}) ([]reflect.Value, error) {
+		in := make([]reflect.Value, len(args))
+		for i, a := range args {
+			if a == nil {
+				in[i] = reflect.Zero(fnTyp.In(i))
+				continue
+			}
+			in[i] = reflect.ValueOf(a)
+		}
+		ret := fnVal.Call(in)
+		if err, ok := ret[nout].Interface().(error); ok && err != nil {
+			return nil, err
+		}
+		return ret[:nout], nil
+	}
+}
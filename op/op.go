@@ -0,0 +1,39 @@
+// Package op provides ready made procs that combine and transform streams.
+//
+// Every constructor returns a *pipe.Proc and accepts pipe.ProcFunc options
+// that are applied after the proc func is set, so options like
+// pipe.WithSource, pipe.WithWorkers or pipe.WithBuffer can be passed through.
+package op
+
+import (
+	"fmt"
+
+	"github.com/stdiopt/pipe"
+)
+
+func newProc(fn interface{}, opts []pipe.ProcFunc, pre ...pipe.ProcFunc) *pipe.Proc {
+	return pipe.NewProc(append(append(pre, pipe.WithFunc(fn)), opts...)...)
+}
+
+// sourceInputs returns the consumer inputs ordered as sources.
+func sourceInputs(c pipe.Consumer, sources []*pipe.Proc) ([]pipe.Input, error) {
+	inputs := c.Inputs()
+	ret := make([]pipe.Input, len(sources))
+	for i, s := range sources {
+		for _, in := range inputs {
+			if in.Origin().Is(s) && in.Output() == 0 {
+				ret[i] = in
+				break
+			}
+		}
+		if ret[i] == nil {
+			return nil, fmt.Errorf("source %v is not linked", s)
+		}
+	}
+	return ret, nil
+}
+
+// drain discards remaining messages so upstream procs can finish.
+func drain(c pipe.Consumer) error {
+	return c.Consume(func(pipe.Message) error { return nil })
+}
@@ -0,0 +1,131 @@
+package op
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/stdiopt/pipe"
+)
+
+// Debounce returns a proc that sends a value only after d passed without
+// receiving a newer one, the pending value is sent when the input closes.
+func Debounce(d time.Duration, opts ...pipe.ProcFunc) *pipe.Proc {
+	return newProc(func(c pipe.Consumer, out pipe.Sender) error {
+		f := forward(c)
+		defer f.stop()
+		timer := time.NewTimer(d)
+		timer.Stop()
+		defer timer.Stop()
+
+		var last interface{}
+		pending := false
+		for {
+			select {
+			case v, ok := <-f.vals:
+				if !ok {
+					if err := f.err(); err != nil || !pending {
+						return err
+					}
+					return out.Send(last)
+				}
+				last, pending = v, true
+				// drain a tick that fired along with the value so the new
+				// value waits d
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(d)
+			case <-timer.C:
+				pending = false
+				if err := out.Send(last); err != nil {
+					return err
+				}
+			}
+		}
+	}, opts)
+}
+
+// Sample returns a proc that sends the latest received value every d if a
+// value was received in that period, the pending value is sent when the
+// input closes.
+func Sample(d time.Duration, opts ...pipe.ProcFunc) *pipe.Proc {
+	return newProc(func(c pipe.Consumer, out pipe.Sender) error {
+		f := forward(c)
+		defer f.stop()
+		ticker := time.NewTicker(d)
+		defer ticker.Stop()
+
+		var last interface{}
+		pending := false
+		for {
+			select {
+			case v, ok := <-f.vals:
+				if !ok {
+					if err := f.err(); err != nil || !pending {
+						return err
+					}
+					return out.Send(last)
+				}
+				last, pending = v, true
+			case <-ticker.C:
+				if !pending {
+					continue
+				}
+				pending = false
+				if err := out.Send(last); err != nil {
+					return err
+				}
+			}
+		}
+	}, opts)
+}
+
+// forwarder consumes in a goroutine so values can be selected along with
+// timers.
+type forwarder struct {
+	vals <-chan interface{}
+	quit chan struct{}
+	errc chan error
+	once sync.Once
+}
+
+// forward consumes c sending the values to the forwarder vals channel, which
+// is closed when consuming ends.
+func forward(c pipe.Consumer) *forwarder {
+	vals := make(chan interface{})
+	f := &forwarder{
+		vals: vals,
+		quit: make(chan struct{}),
+		errc: make(chan error, 1),
+	}
+	go func() {
+		defer close(vals)
+		f.errc <- c.Consume(func(v interface{}) error {
+			select {
+			case <-f.quit:
+				return pipe.ErrStop
+			case vals <- v:
+				return nil
+			}
+		})
+	}()
+	return f
+}
+
+// stop makes the consumer stop on the next value.
+func (f *forwarder) stop() {
+	f.once.Do(func() { close(f.quit) })
+}
+
+// err returns the consume error after vals is closed.
+func (f *forwarder) err() error {
+	err := <-f.errc
+	if errors.Is(err, pipe.ErrStop) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,53 @@
+package op_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stdiopt/pipe"
+	"github.com/stdiopt/pipe/op"
+)
+
+// bursts sends each group of values at once and sleeps between groups.
+func bursts(gap time.Duration, groups ...[]int) *pipe.Proc {
+	return pipe.NewProc(
+		pipe.WithFunc(func(s pipe.Sender) error {
+			for i, g := range groups {
+				if i > 0 {
+					time.Sleep(gap)
+				}
+				for _, v := range g {
+					if err := s.Send(v); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		}),
+	)
+}
+
+func TestDebounce(t *testing.T) {
+	origin := bursts(50*time.Millisecond, []int{1, 2, 3}, []int{4, 5}, []int{6})
+	res := []interface{}{}
+	collect(op.Debounce(10*time.Millisecond, pipe.WithSource(0, origin)), &res)
+	if err := origin.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{3, 5, 6}; !reflect.DeepEqual(res, want) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, res)
+	}
+}
+
+func TestSample(t *testing.T) {
+	origin := bursts(50*time.Millisecond, []int{1, 2, 3}, []int{4, 5})
+	res := []interface{}{}
+	collect(op.Sample(20*time.Millisecond, pipe.WithSource(0, origin)), &res)
+	if err := origin.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{3, 5}; !reflect.DeepEqual(res, want) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, res)
+	}
+}
@@ -0,0 +1,174 @@
+package op
+
+import (
+	"reflect"
+
+	"github.com/stdiopt/pipe"
+)
+
+// Output names of Partition
+const (
+	OutputMatch = "match"
+	OutputRest  = "rest"
+)
+
+var (
+	consumerTyp = reflect.TypeOf((*pipe.Consumer)(nil)).Elem()
+	senderTyp   = reflect.TypeOf((*pipe.Sender)(nil)).Elem()
+)
+
+// Map returns a proc that sends the result of fn for every received value, fn
+// must be a func with a signature like `func(T) (U, error)`.
+func Map(fn interface{}, opts ...pipe.ProcFunc) *pipe.Proc {
+	call := callFunc("func(T) (U, error)", fn, 1, 1)
+	return newProc(func(c pipe.Consumer, out pipe.Sender) error {
+		return c.Consume(func(v interface{}) error {
+			ret, err := call(v)
+			if err != nil {
+				return err
+			}
+			return out.Send(ret[0].Interface())
+		})
+	}, opts)
+}
+
+// Filter returns a proc that only sends the values that match pred, pred must
+// be a func with a signature like `func(T) (bool, error)`.
+func Filter(pred interface{}, opts ...pipe.ProcFunc) *pipe.Proc {
+	call := callFunc("func(T) (bool, error)", pred, 1, 1)
+	return newProc(func(c pipe.Consumer, out pipe.Sender) error {
+		return c.Consume(func(v interface{}) error {
+			ret, err := call(v)
+			if err != nil {
+				return err
+			}
+			if !ret[0].Bool() {
+				return nil
+			}
+			return out.Send(v)
+		})
+	}, opts)
+}
+
+// FlatMap returns a proc that sends each element of the slice returned by fn
+// for every received value, fn must be a func with a signature like
+// `func(T) ([]U, error)`.
+func FlatMap(fn interface{}, opts ...pipe.ProcFunc) *pipe.Proc {
+	call := callFunc("func(T) ([]U, error)", fn, 1, 1)
+	return newProc(func(c pipe.Consumer, out pipe.Sender) error {
+		return c.Consume(func(v interface{}) error {
+			ret, err := call(v)
+			if err != nil {
+				return err
+			}
+			s := ret[0]
+			for i := 0; i < s.Len(); i++ {
+				if err := out.Send(s.Index(i).Interface()); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}, opts)
+}
+
+// Reduce returns a proc that folds every received value with fn starting
+// with init and sends the result when the input closes, fn must be a func
+// with a signature like `func(acc A, v T) (A, error)`.
+//
+// Each worker reduces the values it receives so with multiple workers a
+// partial result is sent per worker.
+func Reduce(init interface{}, fn interface{}, opts ...pipe.ProcFunc) *pipe.Proc {
+	call := callFunc("func(acc A, v T) (A, error)", fn, 2, 1)
+	return newProc(func(c pipe.Consumer, out pipe.Sender) error {
+		acc := init
+		err := c.Consume(func(v interface{}) error {
+			ret, err := call(acc, v)
+			if err != nil {
+				return err
+			}
+			acc = ret[0].Interface()
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if c.Context().Err() != nil {
+			return nil
+		}
+		return out.Send(acc)
+	}, opts)
+}
+
+// Tee returns a proc with n outputs that sends every received value to all
+// of them.
+func Tee(n int, opts ...pipe.ProcFunc) *pipe.Proc {
+	in := []reflect.Type{consumerTyp}
+	for i := 0; i < n; i++ {
+		in = append(in, senderTyp)
+	}
+	fnTyp := reflect.FuncOf(in, []reflect.Type{errTyp}, false)
+	fn := reflect.MakeFunc(fnTyp, func(args []reflect.Value) []reflect.Value {
+		c := args[0].Interface().(pipe.Consumer)
+		outs := make([]pipe.Sender, 0, n)
+		for _, a := range args[1:] {
+			outs = append(outs, a.Interface().(pipe.Sender))
+		}
+		err := c.Consume(func(v interface{}) error {
+			for _, out := range outs {
+				if err := out.Send(v); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		ret := reflect.New(errTyp).Elem()
+		if err != nil {
+			ret.Set(reflect.ValueOf(err))
+		}
+		return []reflect.Value{ret}
+	})
+	return newProc(fn.Interface(), opts)
+}
+
+// Partition returns a proc that sends values matching pred to the "match"
+// output and the others to the "rest" output, pred must be a func with a
+// signature like `func(T) (bool, error)`.
+func Partition(pred interface{}, opts ...pipe.ProcFunc) *pipe.Proc {
+	call := callFunc("func(T) (bool, error)", pred, 1, 1)
+	return newProc(func(c pipe.Consumer, match, rest pipe.Sender) error {
+		return c.Consume(func(v interface{}) error {
+			ret, err := call(v)
+			if err != nil {
+				return err
+			}
+			if ret[0].Bool() {
+				return match.Send(v)
+			}
+			return rest.Send(v)
+		})
+	}, opts, pipe.WithOutputs(OutputMatch, OutputRest))
+}
+
+// Take returns a proc that sends the first n received values and then stops,
+// upstream procs sending only to Take will receive pipe.ErrStop from Send.
+//
+// Each worker takes n values so Take should run with a single worker.
+func Take(n int, opts ...pipe.ProcFunc) *pipe.Proc {
+	return newProc(func(c pipe.Consumer, out pipe.Sender) error {
+		if n <= 0 {
+			return pipe.ErrStop
+		}
+		count := 0
+		return c.Consume(func(v interface{}) error {
+			if err := out.Send(v); err != nil {
+				return err
+			}
+			count++
+			if count >= n {
+				return pipe.ErrStop
+			}
+			return nil
+		})
+	}, opts)
+}
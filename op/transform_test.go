@@ -0,0 +1,188 @@
+package op_test
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/stdiopt/pipe"
+	"github.com/stdiopt/pipe/op"
+	"github.com/stdiopt/pipe/source"
+)
+
+func TestTransform(t *testing.T) {
+	tests := []struct {
+		name    string
+		proc    func(opts ...pipe.ProcFunc) *pipe.Proc
+		input   []int
+		wantRes []interface{}
+		wantErr string
+	}{
+		{
+			name: "map",
+			proc: func(opts ...pipe.ProcFunc) *pipe.Proc {
+				return op.Map(func(v int) (string, error) {
+					return strconv.Itoa(v * 2), nil
+				}, opts...)
+			},
+			input:   []int{1, 2, 3},
+			wantRes: []interface{}{"2", "4", "6"},
+		},
+		{
+			name: "map error",
+			proc: func(opts ...pipe.ProcFunc) *pipe.Proc {
+				return op.Map(func(v int) (int, error) {
+					return 0, errors.New("test")
+				}, opts...)
+			},
+			input:   []int{1},
+			wantRes: []interface{}{},
+			wantErr: "test, origin: <slice>",
+		},
+		{
+			name: "filter",
+			proc: func(opts ...pipe.ProcFunc) *pipe.Proc {
+				return op.Filter(func(v int) (bool, error) {
+					return v&1 == 0, nil
+				}, opts...)
+			},
+			input:   []int{1, 2, 3, 4},
+			wantRes: []interface{}{2, 4},
+		},
+		{
+			name: "flatmap",
+			proc: func(opts ...pipe.ProcFunc) *pipe.Proc {
+				return op.FlatMap(func(v int) ([]int, error) {
+					return []int{v, v}, nil
+				}, opts...)
+			},
+			input:   []int{1, 2},
+			wantRes: []interface{}{1, 1, 2, 2},
+		},
+		{
+			name: "reduce",
+			proc: func(opts ...pipe.ProcFunc) *pipe.Proc {
+				return op.Reduce(0, func(acc, v int) (int, error) {
+					return acc + v, nil
+				}, opts...)
+			},
+			input:   []int{1, 2, 3, 4},
+			wantRes: []interface{}{10},
+		},
+		{
+			name: "tee",
+			proc: func(opts ...pipe.ProcFunc) *pipe.Proc {
+				return op.Tee(2, opts...)
+			},
+			input:   []int{1, 2},
+			wantRes: []interface{}{1, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origin := source.Slice(tt.input, pipe.WithName("slice"))
+			p := tt.proc(pipe.WithSource(0, origin))
+
+			res := []interface{}{}
+			collect(p, &res)
+			err := origin.Run()
+			if want := tt.wantErr; (err == nil && want != "") || (err != nil && err.Error() != want) {
+				t.Errorf("\nwant: %v\n got: %v\n", want, err)
+			}
+			if want := tt.wantRes; !reflect.DeepEqual(res, want) {
+				t.Errorf("\nwant: %v\n got: %v\n", want, res)
+			}
+		})
+	}
+}
+
+func TestTee(t *testing.T) {
+	origin := source.Slice([]int{1, 2, 3})
+	tee := op.Tee(3, pipe.WithSource(0, origin))
+
+	res := [3][]interface{}{}
+	for i := range res {
+		collect(pipe.NewProc(
+			pipe.WithSource(i, tee),
+			pipe.WithFunc(func(c pipe.Consumer, s pipe.Sender) error {
+				return c.Consume(s.Send)
+			}),
+		), &res[i])
+	}
+	if err := origin.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range res {
+		if want := []interface{}{1, 2, 3}; !reflect.DeepEqual(r, want) {
+			t.Errorf("output %d\nwant: %v\n got: %v\n", i, want, r)
+		}
+	}
+}
+
+func TestPartition(t *testing.T) {
+	origin := source.Slice([]int{1, 2, 3, 4, 5, 6})
+	part := op.Partition(func(v int) (bool, error) {
+		return v > 3, nil
+	}, pipe.WithWorkers(3), pipe.WithSource(0, origin))
+
+	match, rest := []interface{}{}, []interface{}{}
+	collect(pipe.NewProc(
+		pipe.WithNamedSource(op.OutputMatch, part),
+		pipe.WithFunc(func(c pipe.Consumer, s pipe.Sender) error {
+			return c.Consume(s.Send)
+		}),
+	), &match)
+	collect(pipe.NewProc(
+		pipe.WithNamedSource(op.OutputRest, part),
+		pipe.WithFunc(func(c pipe.Consumer, s pipe.Sender) error {
+			return c.Consume(s.Send)
+		}),
+	), &rest)
+	if err := origin.Run(); err != nil {
+		t.Fatal(err)
+	}
+	sortInts(match)
+	sortInts(rest)
+	if want := []interface{}{4, 5, 6}; !reflect.DeepEqual(match, want) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, match)
+	}
+	if want := []interface{}{1, 2, 3}; !reflect.DeepEqual(rest, want) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, rest)
+	}
+}
+
+func sortInts(vs []interface{}) {
+	sort.Slice(vs, func(i, j int) bool { return vs[i].(int) < vs[j].(int) })
+}
+
+func TestTake(t *testing.T) {
+	sent := 0
+	origin := pipe.NewProc(
+		pipe.WithFunc(func(s pipe.Sender) error {
+			for i := 0; ; i++ {
+				if err := s.Send(i); err != nil {
+					return err
+				}
+				sent++
+			}
+		}),
+	)
+	double := op.Map(func(v int) (int, error) {
+		return v * 2, nil
+	}, pipe.WithSource(0, origin))
+
+	res := []interface{}{}
+	collect(op.Take(5, pipe.WithSource(0, double)), &res)
+
+	if err := origin.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{0, 2, 4, 6, 8}; !reflect.DeepEqual(res, want) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, res)
+	}
+	if sent > 10 {
+		t.Errorf("origin didn't stop early, sent: %d", sent)
+	}
+}
@@ -0,0 +1,74 @@
+package pipe
+
+import "fmt"
+
+// Pause stops the consumer proc p from receiving messages until Resume is
+// called, messages stay buffered and senders block once the buffers are
+// full. Workers finish the message being consumed and wait in Consume and
+// ConsumeBatch, a partial batch isn't flushed while paused. Pausing a
+// composite proc pauses its internal consumers.
+func (l *Line) Pause(p *Proc) error {
+	nodes, err := l.consumerNodes(p)
+	if err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		n.pause()
+	}
+	return nil
+}
+
+// Resume resumes a proc paused with Pause or PauseAll.
+func (l *Line) Resume(p *Proc) error {
+	nodes, err := l.consumerNodes(p)
+	if err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		n.unpause()
+	}
+	return nil
+}
+
+// PauseAll pauses every consumer proc of the line, procs without a consumer
+// block once their targets buffers are full.
+func (l *Line) PauseAll() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, n := range l.order {
+		if n.consumes() {
+			n.pause()
+		}
+	}
+}
+
+// ResumeAll resumes every paused proc of the line.
+func (l *Line) ResumeAll() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, n := range l.order {
+		n.unpause()
+	}
+}
+
+// consumerNodes returns the nodes of p or of the procs inside composite p.
+func (l *Line) consumerNodes(p *Proc) ([]*node, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if n, ok := l.nodes[p]; ok {
+		if !n.consumes() {
+			return nil, fmt.Errorf("%v: only consumer procs can be paused", p)
+		}
+		return []*node{n}, nil
+	}
+	ret := []*node{}
+	for _, n := range l.order {
+		if n.consumes() && n.proc.inside(p) {
+			ret = append(ret, n)
+		}
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("%v is not running in the line", p)
+	}
+	return ret, nil
+}
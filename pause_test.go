@@ -0,0 +1,141 @@
+package pipe_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stdiopt/pipe"
+)
+
+func TestPause(t *testing.T) {
+	tests := []struct {
+		name    string
+		consume func(c pipe.Consumer, res chan int) error
+	}{
+		{
+			name: "consume",
+			consume: func(c pipe.Consumer, res chan int) error {
+				return c.Consume(func(v int) error {
+					res <- v
+					return nil
+				})
+			},
+		},
+		{
+			name: "inputs",
+			consume: func(c pipe.Consumer, res chan int) error {
+				in := c.Inputs()[0]
+				for {
+					m, ok := in.Recv()
+					if !ok {
+						return nil
+					}
+					res <- m.Value().(int)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		consume := tt.consume
+		t.Run(tt.name, func(t *testing.T) {
+			feed := make(chan int)
+			origin := pipe.NewProc(
+				pipe.WithName("origin"),
+				pipe.WithFunc(func(s pipe.Sender) error {
+					for v := range feed {
+						if err := s.Send(v); err != nil {
+							return err
+						}
+					}
+					return nil
+				}),
+			)
+			res := make(chan int, 10)
+			sink := pipe.NewProc(
+				pipe.WithName("sink"),
+				pipe.WithBuffer(1),
+				pipe.WithSource(0, origin),
+				pipe.WithFunc(func(c pipe.Consumer) error {
+					return consume(c, res)
+				}),
+			)
+
+			l := origin.Start(context.Background())
+			sinkStats := func() pipe.ProcStats {
+				for _, s := range l.Stats() {
+					if s.Proc == sink {
+						return s
+					}
+				}
+				return pipe.ProcStats{}
+			}
+			waitPaused := func() {
+				t.Helper()
+				deadline := time.Now().Add(time.Second)
+				for time.Now().Before(deadline) {
+					if s := sinkStats(); s.Paused && s.States[0] == pipe.WorkerPaused {
+						return
+					}
+					time.Sleep(time.Millisecond)
+				}
+				t.Fatal("sink didn't pause")
+			}
+			expect := func(want int) {
+				t.Helper()
+				select {
+				case got := <-res:
+					if want != got {
+						t.Errorf("\nwant: %v\n got: %v\n", want, got)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("\nwant: %v\n got: nothing\n", want)
+				}
+			}
+			expectNothing := func() {
+				t.Helper()
+				select {
+				case got := <-res:
+					t.Errorf("\nwant: nothing\n got: %v\n", got)
+				case <-time.After(20 * time.Millisecond):
+				}
+			}
+
+			feed <- 1
+			expect(1)
+
+			if err := l.Pause(sink); err != nil {
+				t.Fatal(err)
+			}
+			waitPaused()
+			feed <- 2
+			expectNothing()
+			if want, got := 1, sinkStats().Inputs[0].Len; want != got {
+				t.Errorf("\nwant: %v\n got: %v\n", want, got)
+			}
+			if err := l.Resume(sink); err != nil {
+				t.Fatal(err)
+			}
+			expect(2)
+
+			l.PauseAll()
+			waitPaused()
+			feed <- 3
+			expectNothing()
+			l.ResumeAll()
+			expect(3)
+
+			if err := l.Pause(origin); err == nil {
+				t.Error("pausing a proc without consumer should fail")
+			}
+
+			close(feed)
+			if err := l.Wait(); err != nil {
+				t.Fatal(err)
+			}
+			if want, got := int64(3), sinkStats().Received; want != got {
+				t.Errorf("\nwant: %v\n got: %v\n", want, got)
+			}
+		})
+	}
+}
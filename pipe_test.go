@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -457,3 +458,74 @@ func TestConsumerMiddleware(t *testing.T) {
 		t.Errorf("\nwant: %v\n got: %v\n", want, consumer)
 	}
 }
+
+func TestStop(t *testing.T) {
+	origin := pipe.NewProc(
+		pipe.WithFunc(func(ints pipe.Sender) error {
+			for i := 0; ; i++ {
+				if err := ints.Send(i); err != nil {
+					return err
+				}
+			}
+		}),
+	)
+
+	pipe.NewProc(
+		pipe.WithWorkers(4),
+		pipe.WithSource(0, origin),
+		pipe.WithFunc(func(c pipe.Consumer) error {
+			return c.Consume(func(vv interface{}) error {
+				if v := vv.(int); v >= 5 {
+					return pipe.ErrStop
+				}
+				return nil
+			})
+		}),
+	)
+
+	err := origin.Run()
+	if want := error(nil); err != want {
+		t.Errorf("\nwant: %v\n got: %v\n", want, err)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	origin := pipe.NewProc(
+		pipe.WithFunc(func(ints pipe.Sender) error {
+			for i := 0; i < 10; i++ {
+				if err := ints.Send(i); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	)
+
+	count := int32(0)
+	pipe.NewProc(
+		pipe.WithWorkers(4),
+		pipe.WithRateLimit(100, 1),
+		pipe.WithSource(0, origin),
+		pipe.WithFunc(func(c pipe.Consumer) error {
+			return c.Consume(func(interface{}) error {
+				atomic.AddInt32(&count, 1)
+				return nil
+			})
+		}),
+	)
+
+	mark := time.Now()
+	err := origin.Run()
+	dur := time.Since(mark)
+
+	if want := error(nil); err != want {
+		t.Errorf("\nwant: %v\n got: %v\n", want, err)
+	}
+	if want := int32(10); count != want {
+		t.Errorf("\nwant: %v\n got: %v\n", want, count)
+	}
+	// the limit is shared across workers, 9 messages wait 10ms each
+	if dur < 80*time.Millisecond {
+		t.Errorf("rate limit not applied, took: %v", dur)
+	}
+}
@@ -0,0 +1,88 @@
+package pipe
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// procLabel returns the proc name used in the pprof labels.
+func procLabel(p *Proc) string {
+	if p.name != "" {
+		return p.name
+	}
+	return p.String()
+}
+
+// DumpGoroutines writes the stacks of the goroutines running proc workers
+// grouped by proc, goroutines with the same stack and labels are written
+// once with their count.
+//
+// Workers run with the pprof labels "line", "proc" and "worker" so profiles
+// can also be filtered with `go tool pprof -tagfocus proc=name`.
+func DumpGoroutines(w io.Writer) error {
+	return dumpGoroutines(w, "")
+}
+
+// DumpGoroutines writes the stacks of the line workers like the package
+// DumpGoroutines.
+func (l *Line) DumpGoroutines(w io.Writer) error {
+	return dumpGoroutines(w, strconv.FormatInt(l.id, 10))
+}
+
+// dumpGoroutines dumps the workers of the line with id line or of every line
+// if line is empty.
+func dumpGoroutines(w io.Writer, line string) error {
+	buf := &bytes.Buffer{}
+	if err := pprof.Lookup("goroutine").WriteTo(buf, 1); err != nil {
+		return err
+	}
+
+	groups := map[string][]string{}
+	for _, rec := range strings.Split(buf.String(), "\n\n") {
+		labels := goroutineLabels(rec)
+		proc, ok := labels["proc"]
+		if !ok || (line != "" && labels["line"] != line) {
+			continue
+		}
+		groups[proc] = append(groups[proc], strings.TrimSpace(rec))
+	}
+	procs := make([]string, 0, len(groups))
+	for k := range groups {
+		procs = append(procs, k)
+	}
+	sort.Strings(procs)
+
+	for _, proc := range procs {
+		if _, err := fmt.Fprintf(w, "proc %s\n\n", proc); err != nil {
+			return err
+		}
+		for _, rec := range groups[proc] {
+			if _, err := fmt.Fprintf(w, "%s\n\n", rec); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// goroutineLabels returns the pprof labels of a goroutine profile record.
+func goroutineLabels(rec string) map[string]string {
+	const prefix = "# labels: "
+	for _, line := range strings.Split(rec, "\n") {
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		labels := map[string]string{}
+		if err := json.Unmarshal([]byte(line[len(prefix):]), &labels); err != nil {
+			return nil
+		}
+		return labels
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package pipe_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stdiopt/pipe"
+)
+
+func TestDumpGoroutines(t *testing.T) {
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	origin := pipe.NewProc(
+		pipe.WithName("blocker"),
+		pipe.WithWorkers(2),
+		pipe.WithFunc(func(s pipe.Sender) error {
+			started <- struct{}{}
+			<-release
+			return nil
+		}),
+	)
+	l := origin.Start(context.Background())
+	<-started
+	<-started
+
+	buf := &bytes.Buffer{}
+	if err := pipe.DumpGoroutines(buf); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	if err := l.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := buf.String()
+	for _, want := range []string{
+		"proc blocker\n",
+		fmt.Sprintf(`"line":"%d"`, l.ID()),
+		`"worker":"0"`,
+		`"worker":"1"`,
+		"TestDumpGoroutines",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("\nwant: %v\n got: %v\n", want, got)
+		}
+	}
+}
+
+func TestLineDumpGoroutines(t *testing.T) {
+	release := make(chan struct{})
+	blocker := func(name string, started chan struct{}) *pipe.Proc {
+		return pipe.NewProc(
+			pipe.WithName(name),
+			pipe.WithFunc(func(s pipe.Sender) error {
+				started <- struct{}{}
+				<-release
+				return nil
+			}),
+		)
+	}
+	started := make(chan struct{}, 2)
+	l := blocker("mine", started).Start(context.Background())
+	other := blocker("other", started).Start(context.Background())
+	<-started
+	<-started
+
+	buf := &bytes.Buffer{}
+	if err := l.DumpGoroutines(buf); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	for _, l := range []*pipe.Line{l, other} {
+		if err := l.Wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := buf.String()
+	if want := "proc mine\n"; !strings.Contains(got, want) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, got)
+	}
+	if notWant := "proc other\n"; strings.Contains(got, notWant) {
+		t.Errorf("\nwant: no %v\n got: %v\n", notWant, got)
+	}
+}
@@ -29,9 +29,20 @@ type Proc struct {
 	fn       interface{}
 
 	consumerMiddleware func(ConsumerFunc) ConsumerFunc
+	middlewares        []ConsumerMiddleware
+	limiter            *rateLimiter
+	logger             Logger
 
 	outputs []string
 	targets map[int]group
+	// sources are the procs linking to this proc
+	sources []*Proc
+
+	// sub is set for composite procs and parent for procs inside one
+	sub    *subgraph
+	parent *Proc
+	// cloneOf is the proc this one was copied from by Clone
+	cloneOf *Proc
 }
 
 func (p *Proc) String() string {
@@ -40,8 +51,8 @@ func (p *Proc) String() string {
 	if p.name != "" {
 		ret = p.name
 	}
-	if len(p.outputs) > 0 {
-		ret += ":" + strings.Join(p.outputs, ",")
+	if outputs := p.Outputs(); len(outputs) > 0 {
+		ret += ":" + strings.Join(outputs, ",")
 	}
 	if ret == "" {
 		return fmt.Sprintf("<unnamed#%p>", p)
@@ -68,38 +79,207 @@ func NewProc(opt ...ProcFunc) *Proc {
 }
 
 // Run will start processors sequentially and blocks until all completed
-func (p *Proc) Run() error {
-	return runLine(context.Background(), p)
+func (p *Proc) Run(opts ...RunOption) error {
+	return startLine(context.Background(), p, opts...).Wait()
 }
 
 // RunWithContext starts processors with the given context, if the context is
 // canceled all workers should stop
-func (p *Proc) RunWithContext(ctx context.Context) error {
-	return runLine(ctx, p)
+func (p *Proc) RunWithContext(ctx context.Context, opts ...RunOption) error {
+	return startLine(ctx, p, opts...).Wait()
+}
+
+// Start starts processors with the given context and returns the running
+// Line without waiting for it to complete
+func (p *Proc) Start(ctx context.Context, opts ...RunOption) *Line {
+	return startLine(ctx, p, opts...)
 }
 
 // Link send output to specified procs, 'k' can be an int or string
 // if it is a string it will query params by name declared in 'Output' option
 func (p *Proc) Link(k interface{}, t ...*Proc) {
-	n := -1
-	switch v := k.(type) {
-	case int:
-		n = v
-	case string:
-		n = p.namedOutput(v)
-	}
-
+	n := p.outputIndex(k)
 	if n < 0 {
 		return
 	}
 
+	p.mu.Lock()
 	if p.targets == nil {
 		p.targets = map[int]group{}
 	}
 	p.targets[n] = append(p.targets[n], t...)
+	p.mu.Unlock()
+
+	for _, tt := range t {
+		tt.addSource(p)
+	}
+}
+
+// Unlink removes the links from output k to targets, if no targets are
+// given every link from output k is removed.
+func (p *Proc) Unlink(k interface{}, targets ...*Proc) {
+	n := p.outputIndex(k)
+	if n < 0 {
+		return
+	}
+
+	p.mu.Lock()
+	removed := group{}
+	kept := group{}
+	for _, t := range p.targets[n] {
+		if len(targets) == 0 || containsProc(targets, t) {
+			removed = append(removed, t)
+			continue
+		}
+		kept = append(kept, t)
+	}
+	if len(kept) == 0 {
+		delete(p.targets, n)
+	} else {
+		p.targets[n] = kept
+	}
+	p.mu.Unlock()
+
+	for _, t := range removed {
+		if !p.linksTo(t) {
+			t.removeSource(p)
+		}
+	}
+}
+
+// ReplaceTarget replaces the links from output k to old with links to t, it
+// returns false if output k is not linked to old.
+//
+// A proc can be inserted between two stages by replacing the target and
+// linking the new proc to the old target:
+//
+//	if a.ReplaceTarget(0, b, tap) {
+//		tap.Link(0, b)
+//	}
+func (p *Proc) ReplaceTarget(k interface{}, old, t *Proc) bool {
+	n := p.outputIndex(k)
+	if n < 0 {
+		return false
+	}
+
+	p.mu.Lock()
+	found := false
+	for i, tt := range p.targets[n] {
+		if tt == old {
+			p.targets[n][i] = t
+			found = true
+		}
+	}
+	p.mu.Unlock()
+	if !found {
+		return false
+	}
+
+	t.addSource(p)
+	if !p.linksTo(old) {
+		old.removeSource(p)
+	}
+	return true
+}
+
+// Edge is a link from a proc output to a target proc.
+type Edge struct {
+	From   *Proc
+	Output int
+	To     *Proc
+}
+
+// Targets returns the links from the proc outputs ordered by output.
+func (p *Proc) Targets() []Edge {
+	ret := []Edge{}
+	for _, k := range p.targetKeys() {
+		for _, t := range p.getOutputs(k) {
+			ret = append(ret, Edge{From: p, Output: k, To: t})
+		}
+	}
+	return ret
+}
+
+// Sources returns the links from other procs to this proc ordered by source
+// link time.
+func (p *Proc) Sources() []Edge {
+	p.mu.Lock()
+	sources := append([]*Proc{}, p.sources...)
+	p.mu.Unlock()
+
+	ret := []Edge{}
+	for _, s := range sources {
+		for _, e := range s.Targets() {
+			if e.To == p {
+				ret = append(ret, e)
+			}
+		}
+	}
+	return ret
+}
+
+// Outputs returns the output names declared with WithOutputs.
+func (p *Proc) Outputs() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string{}, p.outputs...)
+}
+
+// NumOutputs returns the number of outputs of the proc func, the number of
+// ports for composite procs.
+func (p *Proc) NumOutputs() int {
+	if p.sub != nil {
+		return len(p.sub.ports)
+	}
+	if p.fn == nil {
+		return 0
+	}
+	fnTyp := reflect.TypeOf(p.fn)
+	n := fnTyp.NumIn()
+	if n > 0 && fnTyp.In(0) == consumerTyp {
+		n--
+	}
+	return n
+}
+
+// RenameOutput renames a declared output, links are kept as they refer to
+// the output index.
+func (p *Proc) RenameOutput(old, name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	i := -1
+	for j, o := range p.outputs {
+		switch o {
+		case old:
+			i = j
+		case name:
+			return fmt.Errorf("output %q already exists", name)
+		}
+	}
+	if i < 0 {
+		return fmt.Errorf("output %q not found", old)
+	}
+	// outputs might share the slice passed to WithOutputs
+	p.outputs = append([]string{}, p.outputs...)
+	p.outputs[i] = name
+	return nil
+}
+
+// outputIndex returns the output index of k, k can be an int or an output
+// name, it returns -1 if not found.
+func (p *Proc) outputIndex(k interface{}) int {
+	switch v := k.(type) {
+	case int:
+		return v
+	case string:
+		return p.namedOutput(v)
+	}
+	return -1
 }
 
 func (p *Proc) namedOutput(k string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	for i, o := range p.outputs {
 		if o == k {
 			return i
@@ -108,6 +288,56 @@ func (p *Proc) namedOutput(k string) int {
 	return -1
 }
 
+// outputName returns the name of output k if declared.
+func (p *Proc) outputName(k int) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if k < len(p.outputs) {
+		return p.outputs[k]
+	}
+	return ""
+}
+
+// linksTo returns true if any output links to t.
+func (p *Proc) linksTo(t *Proc) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, g := range p.targets {
+		if containsProc(g, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Proc) addSource(s *Proc) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !containsProc(p.sources, s) {
+		p.sources = append(p.sources, s)
+	}
+}
+
+func (p *Proc) removeSource(s *Proc) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, ss := range p.sources {
+		if ss == s {
+			p.sources = append(p.sources[:i:i], p.sources[i+1:]...)
+			return
+		}
+	}
+}
+
+func containsProc(g []*Proc, p *Proc) bool {
+	for _, pp := range g {
+		if pp == p {
+			return true
+		}
+	}
+	return false
+}
+
 // getOutputs returns a new copy of outputs
 func (p *Proc) getOutputs(k int) group {
 	p.mu.Lock()
@@ -119,6 +349,14 @@ func (p *Proc) getOutputs(k int) group {
 	return append(group{}, g...)
 }
 
+// workers returns the number of workers to start
+func (p *Proc) workers() int {
+	if p.nworkers <= 0 {
+		return 1
+	}
+	return p.nworkers
+}
+
 // Functional options
 
 // Group groups options in one ProcFunc
@@ -193,6 +431,19 @@ func WithNamedSource(n string, source ...*Proc) ProcFunc {
 // WithConsumerMiddleware sets a ConsumerMiddleware to be used while consuming data.
 func WithConsumerMiddleware(mws ...ConsumerMiddleware) ProcFunc {
 	return func(p *Proc) {
+		p.middlewares = mws
 		p.consumerMiddleware = mergeMiddlewares(mws...)
 	}
 }
+
+// WithRateLimit limits the proc to consume rate messages per second with
+// bursts of up to burst messages, the limit is shared by all workers.
+func WithRateLimit(rate float64, burst int) ProcFunc {
+	return func(p *Proc) { p.limiter = newRateLimiter(rate, burst) }
+}
+
+// WithLogger sets the logger used by the proc middlewares, overriding the
+// line logger.
+func WithLogger(l Logger) ProcFunc {
+	return func(p *Proc) { p.logger = l }
+}
@@ -0,0 +1,95 @@
+package pipe_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stdiopt/pipe"
+)
+
+func TestGraphMutation(t *testing.T) {
+	res := []interface{}{}
+	origin := pipe.NewProc(
+		pipe.WithName("origin"),
+		pipe.WithOutputs("out"),
+		pipe.WithFunc(func(s pipe.Sender) error {
+			for i := 1; i <= 3; i++ {
+				if err := s.Send(i); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	)
+	sink := pipe.NewProc(
+		pipe.WithName("sink"),
+		pipe.WithNamedSource("out", origin),
+		pipe.WithFunc(func(c pipe.Consumer) error {
+			return c.Consume(func(v interface{}) error {
+				res = append(res, v)
+				return nil
+			})
+		}),
+	)
+	other := pipe.NewProc(
+		pipe.WithName("other"),
+		pipe.WithSource(0, origin),
+		pipe.WithFunc(func(c pipe.Consumer) error {
+			return c.Consume(func(v interface{}) error { return nil })
+		}),
+	)
+
+	want := []pipe.Edge{
+		{From: origin, Output: 0, To: sink},
+		{From: origin, Output: 0, To: other},
+	}
+	if got := origin.Targets(); !reflect.DeepEqual(want, got) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, got)
+	}
+	if want, got := want[:1], sink.Sources(); !reflect.DeepEqual(want, got) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, got)
+	}
+
+	origin.Unlink("out", other)
+	if want, got := want[:1], origin.Targets(); !reflect.DeepEqual(want, got) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, got)
+	}
+	if want, got := []pipe.Edge{}, other.Sources(); !reflect.DeepEqual(want, got) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, got)
+	}
+
+	// insert a tap between origin and sink
+	tap := pipe.NewProc(
+		pipe.WithName("tap"),
+		pipe.WithFunc(func(c pipe.Consumer, s pipe.Sender) error {
+			return c.Consume(func(v int) error { return s.Send(v * 10) })
+		}),
+	)
+	if !origin.ReplaceTarget("out", sink, tap) {
+		t.Fatal("expected target to be replaced")
+	}
+	tap.Link(0, sink)
+	if want, got := []pipe.Edge{{From: tap, Output: 0, To: sink}}, sink.Sources(); !reflect.DeepEqual(want, got) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, got)
+	}
+	if origin.ReplaceTarget(0, sink, tap) {
+		t.Error("expected no target to replace")
+	}
+
+	if err := origin.RenameOutput("out", "values"); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := []string{"values"}, origin.Outputs(); !reflect.DeepEqual(want, got) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, got)
+	}
+	if err := origin.RenameOutput("out", "values"); err == nil {
+		t.Error("expected error renaming unknown output")
+	}
+
+	if err := origin.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := []interface{}{10, 20, 30}, res; !reflect.DeepEqual(want, got) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, got)
+	}
+}
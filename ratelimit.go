@@ -0,0 +1,76 @@
+package pipe
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimitConsumer consumer middleware that limits the consumer to rate
+// messages per second with bursts of up to burst messages, the limit is
+// shared by every consumer using the middleware.
+func RateLimitConsumer(rate float64, burst int) ConsumerMiddleware {
+	l := newRateLimiter(rate, burst)
+	return func(fn ConsumerFunc) ConsumerFunc {
+		return func(m Message) error {
+			if err := l.wait(m.Context()); err != nil {
+				return err
+			}
+			return fn(m)
+		}
+	}
+}
+
+// rateLimiter is a token bucket.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait blocks until a token is available or the context is done.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l.rate <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	// reserve the token even if we need to wait for it
+	l.tokens--
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,177 @@
+package pipe
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Attach links t to output k of the running proc p, t and the procs linked
+// from it are started and receive the messages sent from now on, they must
+// not be part of the line already. The proc graph is linked as with Link.
+func (l *Line) Attach(p *Proc, k interface{}, t *Proc) error {
+	i := p.outputIndex(k)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n, err := l.runningOutput(p, k, i)
+	if err != nil {
+		return err
+	}
+	if err := l.checkNew(t); err != nil {
+		return err
+	}
+
+	start := len(l.order)
+	for _, lk := range expandLinks(t, p, i) {
+		in := l.input(lk)
+		l.chans[in.ch] += n.live
+		n.senders[i].outs.add(in)
+	}
+	for _, nn := range l.order[start:] {
+		l.start(nn, nil)
+	}
+	p.Link(i, t)
+	return nil
+}
+
+// Detach unlinks t from output k of the running proc p, it waits for sends
+// in progress and t finishes once it consumed the remaining messages unless
+// it has other sources. The proc graph is unlinked as with Unlink.
+func (l *Line) Detach(p *Proc, k interface{}, t *Proc) error {
+	i := p.outputIndex(k)
+
+	l.mu.Lock()
+	n, err := l.runningOutput(p, k, i)
+	if err != nil {
+		l.mu.Unlock()
+		return err
+	}
+	outs := n.senders[i].outs
+	detached := []*input{}
+	for _, lk := range expandLinks(t, p, i) {
+		tn := l.nodes[lk.target]
+		for _, in := range outs.get() {
+			if tn != nil && containsInput(tn.inputs, in) && !containsInput(detached, in) {
+				detached = append(detached, in)
+			}
+		}
+	}
+	l.mu.Unlock()
+	if len(detached) == 0 {
+		return fmt.Errorf("%v output %v is not linked to %v", p, k, t)
+	}
+
+	// senders are stopped before the channel count drops so no one sends
+	// on a closed channel
+	for _, in := range detached {
+		in.stopSending()
+	}
+	l.mu.Lock()
+	for _, in := range detached {
+		// the channel is already released if every worker exited
+		if c := outs.remove(in); c > 0 && n.live > 0 {
+			l.count(-c*n.live, in)
+		}
+	}
+	l.mu.Unlock()
+	p.Unlink(i, t)
+	return nil
+}
+
+// Replace replaces the func of the running consumer proc p, the current
+// workers stop consuming as if their inputs were closed and the new func
+// consumes the remaining messages, fn must have the same signature as the
+// proc func. Replace returns once the current workers are drained.
+//
+// Funcs that act on input close, like a reduce, see the drain as a close.
+func (l *Line) Replace(p *Proc, fn interface{}) error {
+	fnTyp := reflect.TypeOf(fn)
+	if fnTyp == nil || fnTyp.Kind() != reflect.Func {
+		return fmt.Errorf("replacement must be a func, got %T", fn)
+	}
+	if err := validateProcFunc(fnTyp); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	n, ok := l.nodes[p]
+	switch {
+	case !ok:
+		l.mu.Unlock()
+		return fmt.Errorf("%v is not running in the line", p)
+	case fnTyp.In(0) != consumerTyp:
+		l.mu.Unlock()
+		return fmt.Errorf("%v: only consumer procs can be replaced", p)
+	case reflect.TypeOf(n.fn) != fnTyp:
+		l.mu.Unlock()
+		return fmt.Errorf("%v: replacement must be a %v", p, reflect.TypeOf(n.fn))
+	case n.live == 0:
+		l.mu.Unlock()
+		return fmt.Errorf("%v already finished", p)
+	}
+	prev := n.gen
+	close(prev.drain)
+	n.fn = fn
+	l.start(n, prev)
+	l.mu.Unlock()
+
+	prev.wg.Wait()
+	return nil
+}
+
+// runningOutput returns the node of p if it's still sending on output i,
+// l must be locked.
+func (l *Line) runningOutput(p *Proc, k interface{}, i int) (*node, error) {
+	n, ok := l.nodes[p]
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("%v is not running in the line", p)
+	case i < 0 || i >= len(n.senders):
+		return nil, fmt.Errorf("%v output %v not found", p, k)
+	case n.live == 0:
+		return nil, fmt.Errorf("%v already finished", p)
+	}
+	return n, nil
+}
+
+// checkNew checks that no proc reachable from t is part of the line, running
+// procs can't get new inputs, l must be locked.
+func (l *Line) checkNew(t *Proc) error {
+	visited := map[*Proc]bool{}
+	var walk func(q *Proc) error
+	walk = func(q *Proc) error {
+		if visited[q] {
+			return nil
+		}
+		visited[q] = true
+		if q.sub != nil {
+			for _, in := range q.sub.inputs {
+				if err := walk(in); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if _, ok := l.nodes[q]; ok {
+			return fmt.Errorf("%v is already running in the line", q)
+		}
+		for _, k := range q.linkKeys() {
+			for _, lk := range q.links(k) {
+				if err := walk(lk.target); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return walk(t)
+}
+
+func containsInput(ins []*input, in *input) bool {
+	for _, i := range ins {
+		if i == in {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package pipe_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stdiopt/pipe"
+)
+
+func TestReconfigure(t *testing.T) {
+	feed := make(chan int)
+	origin := pipe.NewProc(
+		pipe.WithName("origin"),
+		pipe.WithFunc(func(s pipe.Sender) error {
+			for v := range feed {
+				if err := s.Send(v); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	)
+	mul := func(n int) func(pipe.Consumer, pipe.Sender) error {
+		return func(c pipe.Consumer, s pipe.Sender) error {
+			return c.Consume(func(v interface{}) error {
+				return s.Send(v.(int) * n)
+			})
+		}
+	}
+	transform := pipe.NewProc(
+		pipe.WithName("transform"),
+		pipe.WithSource(0, origin),
+		pipe.WithFunc(mul(2)),
+	)
+	res := make(chan int, 10)
+	pipe.NewProc(
+		pipe.WithName("sink"),
+		pipe.WithSource(0, transform),
+		pipe.WithFunc(func(c pipe.Consumer) error {
+			return c.Consume(func(v interface{}) error {
+				res <- v.(int)
+				return nil
+			})
+		}),
+	)
+	audit := make(chan int, 10)
+	auditDone := make(chan struct{})
+	auditor := pipe.NewProc(
+		pipe.WithName("audit"),
+		pipe.WithFunc(func(c pipe.Consumer) error {
+			defer close(auditDone)
+			return c.Consume(func(v interface{}) error {
+				audit <- v.(int)
+				return nil
+			})
+		}),
+	)
+
+	l := origin.Start(context.Background())
+	step := func(v, want int) {
+		t.Helper()
+		feed <- v
+		if got := <-res; want != got {
+			t.Errorf("\nwant: %v\n got: %v\n", want, got)
+		}
+	}
+
+	step(1, 2)
+	if err := l.Attach(origin, 0, auditor); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Attach(origin, 0, transform); err == nil {
+		t.Error("attaching a running proc should fail")
+	}
+	step(2, 4)
+	if want, got := 2, <-audit; want != got {
+		t.Errorf("\nwant: %v\n got: %v\n", want, got)
+	}
+
+	if err := l.Replace(transform, func(pipe.Consumer) error { return nil }); err == nil {
+		t.Error("replacing with a different signature should fail")
+	}
+	if err := l.Replace(transform, mul(3)); err != nil {
+		t.Fatal(err)
+	}
+	step(3, 9)
+	if want, got := 3, <-audit; want != got {
+		t.Errorf("\nwant: %v\n got: %v\n", want, got)
+	}
+
+	if err := l.Detach(origin, 0, auditor); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-auditDone:
+	case <-time.After(time.Second):
+		t.Fatal("detached proc didn't finish")
+	}
+	if want, got := 1, len(origin.Targets()); want != got {
+		t.Errorf("\nwant: %v\n got: %v\n", want, got)
+	}
+	if want, got := 4, len(l.Stats()); want != got {
+		t.Errorf("\nwant: %v\n got: %v\n", want, got)
+	}
+	step(4, 12)
+
+	close(feed)
+	if err := l.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 0, len(audit); want != got {
+		t.Errorf("\nwant: %v\n got: %v\n", want, got)
+	}
+}
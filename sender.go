@@ -3,27 +3,133 @@ package pipe
 import (
 	"context"
 	"errors"
+	"sync"
+	"sync/atomic"
 )
 
+// ErrStop can be returned by a consumer func to stop consuming, the
+// consumer proc finishes without error and Send calls from upstream procs
+// that only send to stopped procs return ErrStop, which in turn can be
+// returned to stop them.
+var ErrStop = errors.New("stop")
+
 // Sender a channel writer wrapper
 type Sender interface {
-	// Send a value
+	// Send a value, returns ErrStop if every target proc stopped
 	Send(v interface{}) error
 }
 
 type sender struct {
-	ctx     context.Context
-	origin  *Proc
-	outputs []chan Message
+	ctx    context.Context
+	origin *Proc
+	outs   *outputList
+	// worker is the consumer of the worker sending, nil for procs without
+	// a consumer
+	worker *consumer
 }
 
 func (p sender) Send(v interface{}) error {
-	for _, ch := range p.outputs {
-		select {
-		case <-p.ctx.Done():
-			return errors.New("canceled")
-		case ch <- message{p.origin, v}:
+	return p.send(v, p.tracked())
+}
+
+// send sends v to every output, each message sent holds the acks.
+func (p sender) send(v interface{}, as acks) error {
+	outputs := p.outs.get()
+	stopped := 0
+	for _, in := range outputs {
+		// origin differs from the sender when sending through a composite
+		err := in.send(p.ctx, message{origin: in.origin, value: v, acks: as})
+		switch {
+		case err == ErrStop:
+			stopped++
+		case err != nil:
+			return err
 		}
 	}
+	if stopped > 0 && stopped == len(outputs) {
+		return ErrStop
+	}
 	return nil
 }
+
+// send sends m to the input, it returns ErrStop if the consumer stopped and
+// nil without sending if the input was detached.
+func (in *input) send(ctx context.Context, m message) error {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	if in.detached {
+		return nil
+	}
+	select {
+	case in.ch <- m:
+		in.countSent(m)
+		return nil
+	default:
+	}
+	// channel is full, track blocked senders for stats
+	atomic.AddInt32(&in.blocked, 1)
+	defer atomic.AddInt32(&in.blocked, -1)
+	select {
+	case <-ctx.Done():
+		return errors.New("canceled")
+	case <-in.done:
+		return ErrStop
+	case <-in.detach:
+		return nil
+	case in.ch <- m:
+		in.countSent(m)
+		return nil
+	}
+}
+
+// stopSending detaches the input from its senders, it waits for the
+// senders that are sending to it.
+func (in *input) stopSending() {
+	in.detachOnce.Do(func() { close(in.detach) })
+	in.mu.Lock()
+	in.detached = true
+	in.mu.Unlock()
+}
+
+// outputList is the list of inputs a sender sends to, it's copied on write
+// as it can change while workers are sending.
+type outputList struct {
+	mu  sync.RWMutex
+	ins []*input
+}
+
+func (o *outputList) get() []*input {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.ins
+}
+
+func (o *outputList) add(in *input) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.ins = append(o.ins[:len(o.ins):len(o.ins)], in)
+}
+
+// remove removes every occurrence of in and returns how many were removed.
+func (o *outputList) remove(in *input) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	ins := make([]*input, 0, len(o.ins))
+	for _, i := range o.ins {
+		if i != in {
+			ins = append(ins, i)
+		}
+	}
+	n := len(o.ins) - len(ins)
+	o.ins = ins
+	return n
+}
+
+// countSent counts a message sent through in.
+func (in *input) countSent(m message) {
+	atomic.AddInt64(&in.sent, 1)
+	m.acks.hold()
+	if in.samples != nil {
+		in.samples.add(m.value)
+	}
+}
@@ -0,0 +1,113 @@
+package sink
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/stdiopt/pipe"
+)
+
+// Rotation describes when ToFiles starts a new file, zero values disable
+// the respective limit.
+type Rotation struct {
+	// MaxSize is the maximum file size in bytes
+	MaxSize int64
+	// MaxAge is the maximum time a file is written to
+	MaxAge time.Duration
+}
+
+// ToFiles returns a proc that writes every received value formatted by f to
+// files named by name, a new file with the next sequence number is created
+// when the current one reaches the rotation limits.
+func ToFiles(name func(seq int) string, r Rotation, f Formatter, opts ...pipe.ProcFunc) *pipe.Proc {
+	if f == nil {
+		f = FormatLine
+	}
+	fw := &fileWriter{name: name, rotation: r}
+	return newProc(func(c pipe.Consumer) error {
+		fw.acquire()
+		err := c.Consume(func(v interface{}) error {
+			b, err := f(v)
+			if err != nil {
+				return err
+			}
+			return fw.write(b)
+		})
+		if cerr := fw.release(); err == nil {
+			err = cerr
+		}
+		return err
+	}, opts)
+}
+
+// fileWriter is shared by the proc workers, the last worker to finish
+// closes the current file.
+type fileWriter struct {
+	name     func(seq int) string
+	rotation Rotation
+
+	mu      sync.Mutex
+	workers int
+	seq     int
+	file    *os.File
+	size    int64
+	opened  time.Time
+}
+
+func (w *fileWriter) acquire() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.workers++
+}
+
+func (w *fileWriter) release() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.workers--
+	if w.workers > 0 {
+		return nil
+	}
+	return w.close()
+}
+
+func (w *fileWriter) write(b []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.shouldRotate(len(b)) {
+		if err := w.close(); err != nil {
+			return err
+		}
+		f, err := os.Create(w.name(w.seq))
+		if err != nil {
+			return err
+		}
+		w.seq++
+		w.file, w.size, w.opened = f, 0, time.Now()
+	}
+	n, err := w.file.Write(b)
+	w.size += int64(n)
+	return err
+}
+
+func (w *fileWriter) shouldRotate(n int) bool {
+	switch {
+	case w.file == nil:
+		return true
+	case w.rotation.MaxSize > 0 && w.size > 0 && w.size+int64(n) > w.rotation.MaxSize:
+		return true
+	case w.rotation.MaxAge > 0 && time.Since(w.opened) >= w.rotation.MaxAge:
+		return true
+	}
+	return false
+}
+
+func (w *fileWriter) close() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
@@ -0,0 +1,124 @@
+// Package sink provides ready made procs that terminate streams.
+//
+// Every constructor returns a *pipe.Proc to be linked with pipe.WithSource
+// or pipe.Link, sinks are safe to use with pipe.WithWorkers and
+// pipe.ProcFunc options are applied after the proc func is set.
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+
+	"github.com/stdiopt/pipe"
+)
+
+func newProc(fn interface{}, opts []pipe.ProcFunc) *pipe.Proc {
+	return pipe.NewProc(append([]pipe.ProcFunc{pipe.WithFunc(fn)}, opts...)...)
+}
+
+// Formatter encodes a value to be written by a sink.
+type Formatter func(v interface{}) ([]byte, error)
+
+// FormatLine formats values with fmt.Sprintln.
+func FormatLine(v interface{}) ([]byte, error) {
+	return []byte(fmt.Sprintln(v)), nil
+}
+
+// FormatJSON formats values as JSON lines.
+func FormatJSON(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// valueOf returns v as a value of type t, nil is the zero value of t.
+func valueOf(v interface{}, t reflect.Type) (reflect.Value, error) {
+	if v == nil {
+		switch t.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func:
+			return reflect.Zero(t), nil
+		}
+		return reflect.Value{}, fmt.Errorf("nil is not assignable to %v", t)
+	}
+	vv := reflect.ValueOf(v)
+	if !vv.Type().AssignableTo(t) {
+		return reflect.Value{}, fmt.Errorf("%T is not assignable to %v", v, t)
+	}
+	return vv, nil
+}
+
+// ToSlice returns a proc that appends every received value to the slice
+// pointed by ptr, values not assignable to the slice elements are an error.
+func ToSlice(ptr interface{}, opts ...pipe.ProcFunc) *pipe.Proc {
+	pv := reflect.ValueOf(ptr)
+	if pv.Kind() != reflect.Ptr || pv.Elem().Kind() != reflect.Slice {
+		panic("sink.ToSlice param should be a pointer to a slice")
+	}
+	sv := pv.Elem()
+	var mu sync.Mutex
+	return newProc(func(c pipe.Consumer) error {
+		return c.Consume(func(v interface{}) error {
+			vv, err := valueOf(v, sv.Type().Elem())
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			sv.Set(reflect.Append(sv, vv))
+			return nil
+		})
+	}, opts)
+}
+
+// ToChan returns a proc that sends every received value to the channel ch,
+// the channel is not closed by the proc, values not assignable to the
+// channel elements are an error.
+func ToChan(ch interface{}, opts ...pipe.ProcFunc) *pipe.Proc {
+	chv := reflect.ValueOf(ch)
+	if chv.Kind() != reflect.Chan || chv.Type().ChanDir()&reflect.SendDir == 0 {
+		panic("sink.ToChan param should be a send channel")
+	}
+	return newProc(func(c pipe.Consumer) error {
+		cases := []reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.Context().Done())},
+			{Dir: reflect.SelectSend, Chan: chv},
+		}
+		return c.Consume(func(v interface{}) error {
+			vv, err := valueOf(v, chv.Type().Elem())
+			if err != nil {
+				return err
+			}
+			cases[1].Send = vv
+			if i, _, _ := reflect.Select(cases); i == 0 {
+				return c.Context().Err()
+			}
+			return nil
+		})
+	}, opts)
+}
+
+// ToWriter returns a proc that writes every received value to w formatted by
+// f, f defaults to FormatLine.
+func ToWriter(w io.Writer, f Formatter, opts ...pipe.ProcFunc) *pipe.Proc {
+	if f == nil {
+		f = FormatLine
+	}
+	var mu sync.Mutex
+	return newProc(func(c pipe.Consumer) error {
+		return c.Consume(func(v interface{}) error {
+			b, err := f(v)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			_, err = w.Write(b)
+			return err
+		})
+	}, opts)
+}
@@ -0,0 +1,123 @@
+package sink_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stdiopt/pipe"
+	"github.com/stdiopt/pipe/sink"
+	"github.com/stdiopt/pipe/source"
+)
+
+func TestToSlice(t *testing.T) {
+	origin := source.Slice([]int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+	res := []int{}
+	sink.ToSlice(&res,
+		pipe.WithWorkers(4),
+		pipe.WithSource(0, origin),
+	)
+	if err := origin.Run(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Ints(res)
+	if want := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}; !reflect.DeepEqual(res, want) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, res)
+	}
+}
+
+func TestToSliceValues(t *testing.T) {
+	errTest := errors.New("test")
+	errs := []error{}
+	origin := source.Slice([]interface{}{nil, errTest})
+	sink.ToSlice(&errs, pipe.WithSource(0, origin))
+	if err := origin.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []error{nil, errTest}; !reflect.DeepEqual(errs, want) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, errs)
+	}
+
+	ints := []int{}
+	origin = source.Slice([]interface{}{1, "a"})
+	sink.ToSlice(&ints, pipe.WithSource(0, origin))
+	want := "string is not assignable to int"
+	if err := origin.Run(); err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, err)
+	}
+}
+
+func TestToChan(t *testing.T) {
+	origin := source.Slice([]int{1, 2, 3})
+	ch := make(chan int, 3)
+	sink.ToChan(ch, pipe.WithSource(0, origin))
+	if err := origin.Run(); err != nil {
+		t.Fatal(err)
+	}
+	close(ch)
+	res := []int{}
+	for v := range ch {
+		res = append(res, v)
+	}
+	if want := []int{1, 2, 3}; !reflect.DeepEqual(res, want) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, res)
+	}
+}
+
+func TestToWriter(t *testing.T) {
+	origin := source.Slice([]interface{}{1, "a", map[string]int{"b": 2}})
+	buf := &bytes.Buffer{}
+	sink.ToWriter(buf, sink.FormatJSON, pipe.WithSource(0, origin))
+	if err := origin.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "1\n\"a\"\n{\"b\":2}\n"; buf.String() != want {
+		t.Errorf("\nwant: %q\n got: %q\n", want, buf.String())
+	}
+}
+
+func TestToFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	origin := source.Slice([]string{"aaa", "bbb", "ccc", "ddd", "eee"})
+	sink.ToFiles(
+		func(seq int) string { return filepath.Join(dir, string(rune('0'+seq))) },
+		sink.Rotation{MaxSize: 8},
+		nil,
+		pipe.WithSource(0, origin),
+	)
+	if err := origin.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"0": "aaa\nbbb\n",
+		"1": "ccc\nddd\n",
+		"2": "eee\n",
+	}
+	res := map[string]string{}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		b, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res[f.Name()] = string(b)
+	}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, res)
+	}
+}
@@ -0,0 +1,82 @@
+package sink
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/stdiopt/pipe"
+)
+
+// Insert describes the batched inserts done by ToSQL.
+type Insert struct {
+	// Table to insert into
+	Table string
+	// Columns of the insert statement
+	Columns []string
+	// Values returns the column values for a received value
+	Values func(v interface{}) ([]interface{}, error)
+	// BatchSize is the maximum number of rows per statement, defaults to 100
+	BatchSize int
+	// MaxWait flushes partial batches after this duration, zero waits for
+	// a full batch or the input to close
+	MaxWait time.Duration
+	// Placeholder returns the placeholder for the n-th argument starting at
+	// 1, defaults to '?', use PlaceholderDollar for postgres style
+	Placeholder func(n int) string
+}
+
+// PlaceholderDollar returns postgres style placeholders.
+func PlaceholderDollar(n int) string { return fmt.Sprintf("$%d", n) }
+
+// ToSQL returns a proc that inserts received values in db in batches.
+func ToSQL(db *sql.DB, ins Insert, opts ...pipe.ProcFunc) *pipe.Proc {
+	if ins.BatchSize <= 0 {
+		ins.BatchSize = 100
+	}
+	if ins.Placeholder == nil {
+		ins.Placeholder = func(int) string { return "?" }
+	}
+	return newProc(func(c pipe.Consumer) error {
+		return c.ConsumeBatch(ins.BatchSize, ins.MaxWait, func(vs []interface{}) error {
+			args := make([]interface{}, 0, len(vs)*len(ins.Columns))
+			for _, v := range vs {
+				row, err := ins.Values(v)
+				if err != nil {
+					return err
+				}
+				if len(row) != len(ins.Columns) {
+					return fmt.Errorf("sink: %d values for %d columns", len(row), len(ins.Columns))
+				}
+				args = append(args, row...)
+			}
+			_, err := db.ExecContext(c.Context(), ins.query(len(vs)), args...)
+			return err
+		})
+	}, opts)
+}
+
+func (ins Insert) query(rows int) string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "INSERT INTO %s (%s) VALUES ",
+		ins.Table,
+		strings.Join(ins.Columns, ", "),
+	)
+	n := 0
+	for r := 0; r < rows; r++ {
+		if r > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("(")
+		for i := range ins.Columns {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			n++
+			b.WriteString(ins.Placeholder(n))
+		}
+		b.WriteString(")")
+	}
+	return b.String()
+}
@@ -0,0 +1,132 @@
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stdiopt/pipe"
+	"github.com/stdiopt/pipe/source"
+)
+
+func TestInsertQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		ins  Insert
+		rows int
+		want string
+	}{
+		{
+			name: "default placeholder",
+			ins:  Insert{Table: "t", Columns: []string{"a", "b"}, Placeholder: func(int) string { return "?" }},
+			rows: 2,
+			want: "INSERT INTO t (a, b) VALUES (?, ?), (?, ?)",
+		},
+		{
+			name: "dollar placeholder",
+			ins:  Insert{Table: "t", Columns: []string{"a", "b"}, Placeholder: PlaceholderDollar},
+			rows: 2,
+			want: "INSERT INTO t (a, b) VALUES ($1, $2), ($3, $4)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.ins.query(tt.rows); got != tt.want {
+				t.Errorf("\nwant: %v\n got: %v\n", tt.want, got)
+			}
+		})
+	}
+}
+
+// fakeDB records the statements executed through its connections.
+type fakeDB struct {
+	mu    sync.Mutex
+	execs []fakeExec
+	err   error
+}
+
+type fakeExec struct {
+	query string
+	args  []driver.Value
+}
+
+func (db *fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{db}, nil }
+func (db *fakeDB) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c fakeConn) Close() error                        { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	if c.db.err != nil {
+		return nil, c.db.err
+	}
+	e := fakeExec{query: query}
+	for _, a := range args {
+		e.args = append(e.args, a.Value)
+	}
+	c.db.execs = append(c.db.execs, e)
+	return driver.RowsAffected(len(args)), nil
+}
+
+func TestToSQL(t *testing.T) {
+	ins := Insert{
+		Table:   "t",
+		Columns: []string{"n", "s"},
+		Values: func(v interface{}) ([]interface{}, error) {
+			return []interface{}{v, strings.Repeat("x", v.(int))}, nil
+		},
+		BatchSize: 2,
+	}
+
+	t.Run("batches", func(t *testing.T) {
+		fake := &fakeDB{}
+		origin := source.Slice([]int{1, 2, 3, 4, 5})
+		ToSQL(sql.OpenDB(fake), ins, pipe.WithSource(0, origin))
+		if err := origin.Run(); err != nil {
+			t.Fatal(err)
+		}
+		// the last partial batch is flushed when the input closes
+		want := []fakeExec{
+			{"INSERT INTO t (n, s) VALUES (?, ?), (?, ?)", []driver.Value{int64(1), "x", int64(2), "xx"}},
+			{"INSERT INTO t (n, s) VALUES (?, ?), (?, ?)", []driver.Value{int64(3), "xxx", int64(4), "xxxx"}},
+			{"INSERT INTO t (n, s) VALUES (?, ?)", []driver.Value{int64(5), "xxxxx"}},
+		}
+		if !reflect.DeepEqual(fake.execs, want) {
+			t.Errorf("\nwant: %v\n got: %v\n", want, fake.execs)
+		}
+	})
+
+	t.Run("exec error", func(t *testing.T) {
+		fake := &fakeDB{err: errors.New("table is locked")}
+		origin := source.Slice([]int{1, 2, 3})
+		ToSQL(sql.OpenDB(fake), ins, pipe.WithSource(0, origin))
+		if err := origin.Run(); err == nil || !strings.Contains(err.Error(), "table is locked") {
+			t.Errorf("\nwant: %v\n got: %v\n", fake.err, err)
+		}
+	})
+
+	t.Run("values error", func(t *testing.T) {
+		fake := &fakeDB{}
+		bad := ins
+		bad.Values = func(v interface{}) ([]interface{}, error) { return []interface{}{v}, nil }
+		origin := source.Slice([]int{1})
+		ToSQL(sql.OpenDB(fake), bad, pipe.WithSource(0, origin))
+		want := "1 values for 2 columns"
+		if err := origin.Run(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("\nwant: %v\n got: %v\n", want, err)
+		}
+		if len(fake.execs) != 0 {
+			t.Errorf("\nwant: no execs\n got: %v\n", fake.execs)
+		}
+	})
+}
@@ -0,0 +1,160 @@
+// Package source provides ready made procs that originate streams.
+//
+// Every constructor returns a *pipe.Proc that can be used as the origin of a
+// line, the proc stops when the line context is canceled and its errors are
+// returned by Run, pipe.ProcFunc options are applied after the proc func is
+// set.
+//
+// Sources send every value once per worker so they should run with a single
+// worker.
+package source
+
+import (
+	"bufio"
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/stdiopt/pipe"
+)
+
+func newProc(fn interface{}, opts []pipe.ProcFunc) *pipe.Proc {
+	return pipe.NewProc(append([]pipe.ProcFunc{pipe.WithFunc(fn)}, opts...)...)
+}
+
+// Slice returns a proc that sends every element of the slice s.
+func Slice(s interface{}, opts ...pipe.ProcFunc) *pipe.Proc {
+	sv := reflect.ValueOf(s)
+	if sv.Kind() != reflect.Slice && sv.Kind() != reflect.Array {
+		panic("source.Slice param should be a slice")
+	}
+	return newProc(func(_ pipe.Consumer, out pipe.Sender) error {
+		for i := 0; i < sv.Len(); i++ {
+			if err := out.Send(sv.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, opts)
+}
+
+// Chan returns a proc that sends every value received from the channel ch
+// until it is closed.
+func Chan(ch interface{}, opts ...pipe.ProcFunc) *pipe.Proc {
+	chv := reflect.ValueOf(ch)
+	if chv.Kind() != reflect.Chan || chv.Type().ChanDir()&reflect.RecvDir == 0 {
+		panic("source.Chan param should be a receive channel")
+	}
+	return newProc(func(c pipe.Consumer, out pipe.Sender) error {
+		cases := []reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.Context().Done())},
+			{Dir: reflect.SelectRecv, Chan: chv},
+		}
+		for {
+			i, v, ok := reflect.Select(cases)
+			if i == 0 {
+				return c.Context().Err()
+			}
+			if !ok {
+				return nil
+			}
+			if err := out.Send(v.Interface()); err != nil {
+				return err
+			}
+		}
+	}, opts)
+}
+
+// Lines returns a proc that sends each line read from r as a string.
+func Lines(r io.Reader, opts ...pipe.ProcFunc) *pipe.Proc {
+	return Scan(r, bufio.ScanLines, opts...)
+}
+
+// Scan returns a proc that splits r with split and sends each token as a
+// string.
+func Scan(r io.Reader, split bufio.SplitFunc, opts ...pipe.ProcFunc) *pipe.Proc {
+	return newProc(func(_ pipe.Consumer, out pipe.Sender) error {
+		return scan(r, split, out)
+	}, opts)
+}
+
+// Open returns a proc that calls open when it runs and splits the reader
+// like Scan, the reader is closed when the proc returns.
+func Open(open func() (io.ReadCloser, error), split bufio.SplitFunc, opts ...pipe.ProcFunc) *pipe.Proc {
+	return newProc(func(_ pipe.Consumer, out pipe.Sender) error {
+		r, err := open()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		return scan(r, split, out)
+	}, opts)
+}
+
+func scan(r io.Reader, split bufio.SplitFunc, out pipe.Sender) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Split(split)
+	for scanner.Scan() {
+		if err := out.Send(scanner.Text()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// Walk returns a proc that walks the directory tree rooted at root and sends
+// the path of every file that is not a directory.
+func Walk(root string, opts ...pipe.ProcFunc) *pipe.Proc {
+	return newProc(func(_ pipe.Consumer, out pipe.Sender) error {
+		return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			return out.Send(path)
+		})
+	}, opts)
+}
+
+// Interval returns a proc that sends the current time every d, it stops
+// after n values or runs until the line is canceled if n <= 0.
+func Interval(d time.Duration, n int, opts ...pipe.ProcFunc) *pipe.Proc {
+	return newProc(func(c pipe.Consumer, out pipe.Sender) error {
+		t := time.NewTicker(d)
+		defer t.Stop()
+		for i := 0; n <= 0 || i < n; i++ {
+			select {
+			case <-c.Context().Done():
+				return c.Context().Err()
+			case now := <-t.C:
+				if err := out.Send(now); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}, opts)
+}
+
+// Rows returns a proc that sends the value returned by scan for each row,
+// rows are closed when the proc finishes.
+func Rows(rows *sql.Rows, scan func(rows *sql.Rows) (interface{}, error), opts ...pipe.ProcFunc) *pipe.Proc {
+	return newProc(func(_ pipe.Consumer, out pipe.Sender) error {
+		defer rows.Close()
+		for rows.Next() {
+			v, err := scan(rows)
+			if err != nil {
+				return err
+			}
+			if err := out.Send(v); err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+	}, opts)
+}
@@ -0,0 +1,135 @@
+package source_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stdiopt/pipe"
+	"github.com/stdiopt/pipe/source"
+)
+
+func collect(t *testing.T, origin *pipe.Proc) []interface{} {
+	t.Helper()
+	res := []interface{}{}
+	pipe.NewProc(
+		pipe.WithSource(0, origin),
+		pipe.WithFunc(func(c pipe.Consumer) error {
+			return c.Consume(func(v interface{}) error {
+				res = append(res, v)
+				return nil
+			})
+		}),
+	)
+	if err := origin.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a", "b/c", "b/d"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ch := make(chan int, 3)
+	ch <- 1
+	ch <- 2
+	ch <- 3
+	close(ch)
+
+	tests := []struct {
+		name    string
+		origin  *pipe.Proc
+		wantRes []interface{}
+	}{
+		{
+			name:    "slice",
+			origin:  source.Slice([]string{"a", "b"}),
+			wantRes: []interface{}{"a", "b"},
+		},
+		{
+			name:    "chan",
+			origin:  source.Chan(ch),
+			wantRes: []interface{}{1, 2, 3},
+		},
+		{
+			name:    "lines",
+			origin:  source.Lines(strings.NewReader("one\ntwo\nthree\n")),
+			wantRes: []interface{}{"one", "two", "three"},
+		},
+		{
+			name:    "scan",
+			origin:  source.Scan(strings.NewReader("one two  three"), bufio.ScanWords),
+			wantRes: []interface{}{"one", "two", "three"},
+		},
+		{
+			name: "open",
+			origin: source.Open(func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(strings.NewReader("one\ntwo\n")), nil
+			}, bufio.ScanLines),
+			wantRes: []interface{}{"one", "two"},
+		},
+		{
+			name:   "walk",
+			origin: source.Walk(dir),
+			wantRes: []interface{}{
+				filepath.Join(dir, "a"),
+				filepath.Join(dir, "b/c"),
+				filepath.Join(dir, "b/d"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := collect(t, tt.origin)
+			if want := tt.wantRes; !reflect.DeepEqual(res, want) {
+				t.Errorf("\nwant: %v\n got: %v\n", want, res)
+			}
+		})
+	}
+}
+
+func TestInterval(t *testing.T) {
+	res := collect(t, source.Interval(time.Millisecond, 3))
+	if want := 3; len(res) != want {
+		t.Errorf("\nwant: %v\n got: %v\n", want, len(res))
+	}
+	times := make([]time.Time, len(res))
+	for i, v := range res {
+		times[i] = v.(time.Time)
+	}
+	if !sort.SliceIsSorted(times, func(i, j int) bool { return times[i].Before(times[j]) }) {
+		t.Errorf("times not sorted: %v", times)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	origin := source.Chan(make(chan int))
+	err := origin.RunWithContext(ctx)
+	if want := context.DeadlineExceeded; err != want {
+		t.Errorf("\nwant: %v\n got: %v\n", want, err)
+	}
+}
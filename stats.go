@@ -0,0 +1,288 @@
+package pipe
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WorkerState is the state of a proc worker goroutine.
+type WorkerState int32
+
+// Worker states
+const (
+	// WorkerBusy is running the proc func or a consume callback
+	WorkerBusy WorkerState = iota
+	// WorkerIdle is waiting for messages
+	WorkerIdle
+	// WorkerDone returned
+	WorkerDone
+	// WorkerPaused is waiting for the proc to be resumed
+	WorkerPaused
+)
+
+func (s WorkerState) String() string {
+	switch s {
+	case WorkerBusy:
+		return "busy"
+	case WorkerIdle:
+		return "idle"
+	case WorkerDone:
+		return "done"
+	case WorkerPaused:
+		return "paused"
+	}
+	return fmt.Sprintf("WorkerState(%d)", int32(s))
+}
+
+// ErrorRecord is an error returned by a proc or by one of its consume
+// callbacks.
+type ErrorRecord struct {
+	Time time.Time
+	Proc *Proc
+	// Origin is the origin of the message being consumed if any
+	Origin *Proc
+	Err    error
+}
+
+// Sample is a message value sampled from a link.
+type Sample struct {
+	Time  time.Time
+	Value interface{}
+}
+
+// WithErrorHistory sets the number of recent errors kept by the line, the
+// default is 32.
+func WithErrorHistory(n int) RunOption {
+	return func(l *Line) { l.errs.size = n }
+}
+
+// WithSampling keeps the last size values of every nth message sent through
+// each link, sampling is disabled by default.
+func WithSampling(every, size int) RunOption {
+	return func(l *Line) {
+		if every <= 0 || size <= 0 {
+			l.sampling = nil
+			return
+		}
+		l.sampling = &sampling{every: every, size: size}
+	}
+}
+
+// Root returns the proc the line was started from.
+func (l *Line) Root() *Proc { return l.root }
+
+// Errors returns the recent errors, oldest first.
+func (l *Line) Errors() []ErrorRecord {
+	l.errs.Lock()
+	defer l.errs.Unlock()
+	return append([]ErrorRecord{}, l.errs.list...)
+}
+
+// errorHistory keeps the last size errors.
+type errorHistory struct {
+	sync.Mutex
+	size int
+	list []ErrorRecord
+}
+
+func (h *errorHistory) add(p, origin *Proc, err error) {
+	h.Lock()
+	defer h.Unlock()
+	if h.size <= 0 {
+		return
+	}
+	if len(h.list) >= h.size {
+		h.list = append(h.list[:0], h.list[len(h.list)-h.size+1:]...)
+	}
+	h.list = append(h.list, ErrorRecord{
+		Time:   time.Now(),
+		Proc:   p,
+		Origin: origin,
+		Err:    err,
+	})
+}
+
+type sampling struct {
+	every int
+	size  int
+}
+
+// samples is a ring of sampled values of a link.
+type samples struct {
+	sync.Mutex
+	every int
+	n     int
+	next  int
+	list  []Sample
+}
+
+func (s *samples) add(v interface{}) {
+	s.Lock()
+	defer s.Unlock()
+	s.n++
+	if s.n%s.every != 0 {
+		return
+	}
+	smp := Sample{Time: time.Now(), Value: v}
+	if len(s.list) < cap(s.list) {
+		s.list = append(s.list, smp)
+		return
+	}
+	s.list[s.next] = smp
+	s.next = (s.next + 1) % len(s.list)
+}
+
+// get returns the samples oldest first.
+func (s *samples) get() []Sample {
+	if s == nil {
+		return nil
+	}
+	s.Lock()
+	defer s.Unlock()
+	return append(append([]Sample{}, s.list[s.next:]...), s.list[:s.next]...)
+}
+
+// ProcStats are the runtime counters of a proc in a running line.
+type ProcStats struct {
+	Proc *Proc
+	// ID is the proc id used in the graph dumps
+	ID string
+	// Workers is the configured number of workers and Running the workers
+	// that didn't return yet
+	Workers int
+	Running int
+	// Received is the number of messages delivered to the consumer
+	Received int64
+	// Sent is the number of messages sent to all linked targets
+	Sent int64
+	// Errors is the number of workers that returned an error
+	Errors int64
+	// Skipped is the number of messages skipped by middlewares such as
+	// DedupConsumer
+	Skipped int64
+	// Rate is the received messages per second over the last second or
+	// more, since the line started on the first Stats call
+	Rate float64
+	// States is the current state of each worker
+	States []WorkerState
+	// Paused is true while the proc is paused
+	Paused bool
+
+	Inputs []InputStats
+}
+
+// InputStats are the runtime counters of a link between a source output and
+// a proc.
+type InputStats struct {
+	Origin *Proc
+	Output int
+	// Sent is the number of messages sent through this link
+	Sent int64
+	// Len and Cap are the current queue size and the buffer size
+	Len int
+	Cap int
+	// Blocked is the number of senders currently waiting on a full queue
+	Blocked int
+	// Samples are the last sampled values if the line runs WithSampling
+	Samples []Sample
+}
+
+// Fill returns the ratio of the queue in use, for unbuffered links it's 1
+// if any sender is blocked.
+func (s InputStats) Fill() float64 {
+	if s.Cap == 0 {
+		if s.Blocked > 0 {
+			return 1
+		}
+		return 0
+	}
+	return float64(s.Len) / float64(s.Cap)
+}
+
+// Stats returns a snapshot of the line procs counters in the order they
+// were started.
+func (l *Line) Stats() []ProcStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	g := newGraph(l.root)
+	now := time.Now()
+	ret := make([]ProcStats, 0, len(l.order))
+	for _, n := range l.order {
+		s := n.stats(now, l.started)
+		// detached procs are no longer in the graph
+		if gn, ok := g.procs[n.proc]; ok {
+			s.ID = gn.ID
+		}
+		ret = append(ret, s)
+	}
+	return ret
+}
+
+// rateWindow is the minimum time the rate is computed over.
+const rateWindow = time.Second
+
+// rateSample is the received counter of a node at some time.
+type rateSample struct {
+	at       time.Time
+	received int64
+}
+
+// rate returns the received messages per second since a sample at least
+// rateWindow old, samples are taken on each Stats call so the rate follows
+// the last window the stats are polled at, l must be locked.
+func (n *node) rate(now time.Time, started time.Time, received int64) float64 {
+	if n.lastRate.at.IsZero() {
+		n.prevRate = rateSample{at: started}
+		n.lastRate = n.prevRate
+	}
+	base := n.prevRate
+	if now.Sub(n.lastRate.at) >= rateWindow {
+		base = n.lastRate
+		n.prevRate, n.lastRate = n.lastRate, rateSample{now, received}
+	}
+	elapsed := now.Sub(base.at).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(received-base.received) / elapsed
+}
+
+func (n *node) stats(now time.Time, started time.Time) ProcStats {
+	s := ProcStats{
+		Proc:     n.proc,
+		Workers:  n.proc.workers(),
+		Running:  int(atomic.LoadInt32(&n.running)),
+		Received: atomic.LoadInt64(&n.received),
+		Errors:   atomic.LoadInt64(&n.errors),
+		Skipped:  atomic.LoadInt64(&n.skipped),
+		Paused:   n.isPaused(),
+	}
+	s.Rate = n.rate(now, started, s.Received)
+	for i := range n.states {
+		s.States = append(s.States, WorkerState(atomic.LoadInt32(&n.states[i])))
+	}
+	for _, snd := range n.senders {
+		for _, in := range snd.outs.get() {
+			s.Sent += atomic.LoadInt64(&in.sent)
+		}
+	}
+	for _, in := range n.inputs {
+		s.Inputs = append(s.Inputs, in.stats())
+	}
+	return s
+}
+
+func (in *input) stats() InputStats {
+	return InputStats{
+		Origin:  in.origin,
+		Output:  in.output,
+		Sent:    atomic.LoadInt64(&in.sent),
+		Len:     len(in.ch),
+		Cap:     cap(in.ch),
+		Blocked: int(atomic.LoadInt32(&in.blocked)),
+		Samples: in.samples.get(),
+	}
+}
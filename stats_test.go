@@ -0,0 +1,144 @@
+package pipe_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stdiopt/pipe"
+)
+
+func TestLineStats(t *testing.T) {
+	origin := pipe.NewProc(
+		pipe.WithName("origin"),
+		pipe.WithFunc(func(s pipe.Sender) error {
+			for i := 0; i < 5; i++ {
+				if err := s.Send(i); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	)
+	release := make(chan struct{})
+	sink := pipe.NewProc(
+		pipe.WithName("sink"),
+		pipe.WithBuffer(2),
+		pipe.WithSource(0, origin),
+		pipe.WithFunc(func(c pipe.Consumer) error {
+			return c.Consume(func(v interface{}) error {
+				<-release
+				return nil
+			})
+		}),
+	)
+
+	l := origin.Start(context.Background())
+
+	// sink holds 1 message, 2 are queued and origin is blocked sending
+	var sinkStats pipe.ProcStats
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		for _, s := range l.Stats() {
+			if s.Proc == sink {
+				sinkStats = s
+			}
+		}
+		if len(sinkStats.Inputs) == 1 && sinkStats.Inputs[0].Blocked == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if want, got := 1, len(sinkStats.Inputs); want != got {
+		t.Fatalf("\nwant: %v\n got: %v\n", want, got)
+	}
+	in := sinkStats.Inputs[0]
+	want := pipe.InputStats{Origin: origin, Sent: 3, Len: 2, Cap: 2, Blocked: 1}
+	if got := in; !reflect.DeepEqual(want, got) {
+		t.Errorf("\nwant: %+v\n got: %+v\n", want, got)
+	}
+	if want, got := int64(1), sinkStats.Received; want != got {
+		t.Errorf("\nwant: %v\n got: %v\n", want, got)
+	}
+
+	dot := pipe.DumpLiveDOT(l)
+	for _, want := range []string{
+		`"origin" -> "sink" [label="sent: 3\nblocked: 1"]`,
+		`"sink"[shape=circle fillcolor="#ee7777"`,
+		`queue: 2/2`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("\nwant: %v\n got: %v\n", want, dot)
+		}
+	}
+
+	close(release)
+	if err := l.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range l.Stats() {
+		if s.Proc != sink {
+			continue
+		}
+		if want, got := int64(5), s.Received; want != got {
+			t.Errorf("\nwant: %v\n got: %v\n", want, got)
+		}
+		if want, got := 0, s.Running; want != got {
+			t.Errorf("\nwant: %v\n got: %v\n", want, got)
+		}
+	}
+}
+
+func TestStatsRate(t *testing.T) {
+	release := make(chan struct{})
+	origin := pipe.NewProc(
+		pipe.WithFunc(func(s pipe.Sender) error {
+			for i := 0; i < 5; i++ {
+				if err := s.Send(i); err != nil {
+					return err
+				}
+			}
+			<-release
+			return nil
+		}),
+	)
+	received := make(chan struct{}, 5)
+	sink := pipe.NewProc(
+		pipe.WithSource(0, origin),
+		pipe.WithFunc(func(c pipe.Consumer) error {
+			return c.Consume(func(interface{}) error {
+				received <- struct{}{}
+				return nil
+			})
+		}),
+	)
+	l := origin.Start(context.Background())
+	rate := func() float64 {
+		for _, s := range l.Stats() {
+			if s.Proc == sink {
+				return s.Rate
+			}
+		}
+		return 0
+	}
+	for i := 0; i < 5; i++ {
+		<-received
+	}
+
+	// the rate covers the first second, then the stalled one
+	time.Sleep(1100 * time.Millisecond)
+	if got := rate(); got <= 0 {
+		t.Errorf("\nwant: > 0\n got: %v\n", got)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if want, got := 0.0, rate(); want != got {
+		t.Errorf("\nwant: %v\n got: %v\n", want, got)
+	}
+
+	close(release)
+	if err := l.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,149 @@
+package pipe
+
+import "sort"
+
+// Port maps a composite proc output to the output of one of its internal
+// procs, Output can be an int or an output name.
+type Port struct {
+	Proc   *Proc
+	Output interface{}
+}
+
+type port struct {
+	proc   *Proc
+	output int
+}
+
+// subgraph holds the internal procs of a composite proc.
+type subgraph struct {
+	inputs []*Proc
+	ports  []port
+}
+
+// WithSubgraph turns the proc into a composite of the procs linked from
+// inputs, messages sent to the composite are sent to every input proc and
+// the composite outputs map to the internal proc outputs in ports order.
+//
+// The composite can be linked like any other proc, it's flattened when the
+// line starts so it has no workers of its own and the func, workers and
+// buffer options are ignored, messages from its outputs have the composite
+// as origin.
+//
+//	enrich := pipe.NewProc(
+//		pipe.WithName("enrich"),
+//		pipe.WithOutputs("out"),
+//		pipe.WithSubgraph([]*pipe.Proc{parse}, pipe.Port{Proc: encode}),
+//	)
+func WithSubgraph(inputs []*Proc, ports ...Port) ProcFunc {
+	return func(p *Proc) {
+		sub := &subgraph{inputs: inputs}
+		for _, pt := range ports {
+			n := -1
+			switch v := pt.Output.(type) {
+			case nil:
+				n = 0
+			case int:
+				n = v
+			case string:
+				n = pt.Proc.namedOutput(v)
+			}
+			if n < 0 {
+				panic("subgraph port output not found")
+			}
+			sub.ports = append(sub.ports, port{pt.Proc, n})
+		}
+		p.sub = sub
+
+		visited := map[*Proc]bool{}
+		var walk func(t *Proc)
+		walk = func(t *Proc) {
+			if visited[t] || t == p {
+				return
+			}
+			visited[t] = true
+			if t.parent == nil {
+				t.parent = p
+			}
+			for _, k := range t.targetKeys() {
+				for _, tt := range t.getOutputs(k) {
+					walk(tt)
+				}
+			}
+		}
+		for _, in := range inputs {
+			walk(in)
+		}
+	}
+}
+
+// inside returns true if p is an internal proc of composite c, directly or
+// through nested composites.
+func (p *Proc) inside(c *Proc) bool {
+	for q := p.parent; q != nil; q = q.parent {
+		if q == c {
+			return true
+		}
+	}
+	return false
+}
+
+// link is a resolved link from a proc output to a regular proc, origin and
+// output are the ones seen by the target which differ from the sending proc
+// when sending through a composite output.
+type link struct {
+	target *Proc
+	origin *Proc
+	output int
+}
+
+// links resolves the targets of output k, expanding composite procs to
+// their input procs and following composite ports to the composite targets.
+func (p *Proc) links(k int) []link {
+	ret := []link{}
+	for _, t := range p.getOutputs(k) {
+		ret = append(ret, expandLinks(t, p, k)...)
+	}
+	if c := p.parent; c != nil {
+		for i, pt := range c.sub.ports {
+			if pt.proc == p && pt.output == k {
+				ret = append(ret, c.links(i)...)
+			}
+		}
+	}
+	return ret
+}
+
+func expandLinks(t, origin *Proc, output int) []link {
+	if t.sub == nil {
+		return []link{{t, origin, output}}
+	}
+	ret := []link{}
+	for _, in := range t.sub.inputs {
+		ret = append(ret, expandLinks(in, origin, output)...)
+	}
+	return ret
+}
+
+// linkKeys returns the sorted output indexes that have links, including the
+// ones mapped to composite ports.
+func (p *Proc) linkKeys() []int {
+	keys := p.targetKeys()
+	c := p.parent
+	if c == nil {
+		return keys
+	}
+	for _, pt := range c.sub.ports {
+		if pt.proc != p {
+			continue
+		}
+		found := false
+		for _, k := range keys {
+			found = found || k == pt.output
+		}
+		if !found {
+			keys = append(keys, pt.output)
+		}
+	}
+	sort.Ints(keys)
+	return keys
+}
@@ -0,0 +1,126 @@
+package pipe_test
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/stdiopt/pipe"
+)
+
+func TestSubgraph(t *testing.T) {
+	// parse -> validate -> encode, invalid values go to the "invalid" output
+	parse := pipe.NewProc(
+		pipe.WithName("parse"),
+		pipe.WithFunc(func(c pipe.Consumer, out pipe.Sender) error {
+			return c.Consume(func(v int) error { return out.Send(v * 10) })
+		}),
+	)
+	validate := pipe.NewProc(
+		pipe.WithName("validate"),
+		pipe.WithOutputs("valid", "invalid"),
+		pipe.WithSource(0, parse),
+		pipe.WithFunc(func(c pipe.Consumer, valid, invalid pipe.Sender) error {
+			return c.Consume(func(v int) error {
+				if v > 30 {
+					return invalid.Send(v)
+				}
+				return valid.Send(v)
+			})
+		}),
+	)
+	encode := pipe.NewProc(
+		pipe.WithName("encode"),
+		pipe.WithNamedSource("valid", validate),
+		pipe.WithFunc(func(c pipe.Consumer, out pipe.Sender) error {
+			return c.Consume(func(v int) error { return out.Send(fmt.Sprint(v)) })
+		}),
+	)
+	origin := pipe.NewProc(
+		pipe.WithName("origin"),
+		pipe.WithFunc(func(s pipe.Sender) error {
+			for i := 1; i <= 4; i++ {
+				if err := s.Send(i); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	)
+	composite := pipe.NewProc(
+		pipe.WithName("enrich"),
+		pipe.WithSource(0, origin),
+		pipe.WithOutputs("out", "invalid"),
+		pipe.WithSubgraph(
+			[]*pipe.Proc{parse},
+			pipe.Port{Proc: encode},
+			pipe.Port{Proc: validate, Output: "invalid"},
+		),
+	)
+
+	type result struct {
+		origin string
+		value  interface{}
+	}
+	collect := func(res *[]result) func(c pipe.Consumer) error {
+		return func(c pipe.Consumer) error {
+			return c.Consume(func(m pipe.Message) error {
+				*res = append(*res, result{m.Origin().String(), m.Value()})
+				return nil
+			})
+		}
+	}
+	out, invalid := []result{}, []result{}
+	pipe.NewProc(
+		pipe.WithName("out"),
+		pipe.WithNamedSource("out", composite),
+		pipe.WithFunc(collect(&out)),
+	)
+	pipe.NewProc(
+		pipe.WithName("invalid"),
+		pipe.WithNamedSource("invalid", composite),
+		pipe.WithFunc(collect(&invalid)),
+	)
+
+	if err := origin.Run(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].value.(string) < out[j].value.(string) })
+	want := []result{
+		{"<enrich:out,invalid>", "10"},
+		{"<enrich:out,invalid>", "20"},
+		{"<enrich:out,invalid>", "30"},
+	}
+	if !reflect.DeepEqual(want, out) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, out)
+	}
+	if want, got := []result{{"<enrich:out,invalid>", 40}}, invalid; !reflect.DeepEqual(want, got) {
+		t.Errorf("\nwant: %v\n got: %v\n", want, got)
+	}
+
+	wantDOT := `digraph {
+	node[shape=square, style="filled,rounded", width=1, color="#aaaaaa"]
+	"origin" -> "parse"
+	"parse" -> "validate"
+	"validate" -> "encode" [label="valid"]
+	"validate" -> "invalid" [label="invalid"]
+	"encode" -> "out" [label="out"]
+	"origin"[shape=circle, fillcolor="#77ee77"]
+	"invalid"[shape=circle fillcolor="#aaaaff"]
+	"out"[shape=circle fillcolor="#aaaaff"]
+	subgraph "cluster_enrich" {
+		label="enrich"
+		"parse"
+		"validate"
+		"encode"
+	}
+}
+`
+	if got := pipe.DumpDOT(origin); got != wantDOT {
+		t.Errorf("\nwant: %v\n got: %v\n", wantDOT, got)
+	}
+	if got := pipe.DumpDOT(pipe.Clone(origin)); got != wantDOT {
+		t.Errorf("\nwant: %v\n got: %v\n", wantDOT, got)
+	}
+}
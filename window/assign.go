@@ -0,0 +1,91 @@
+package window
+
+import "time"
+
+// assigner computes the windows for a value at time t, it returns the target
+// panes for the value and the updated list of panes for the key, windows
+// ending before the watermark wm are not assigned and late is true if the
+// value only belongs to such windows.
+type assigner interface {
+	assign(panes []*pane, t, wm time.Time) (target, all []*pane, late bool)
+}
+
+type tumbling struct {
+	size time.Duration
+}
+
+func (a tumbling) assign(panes []*pane, t, wm time.Time) ([]*pane, []*pane, bool) {
+	return assignStarts(panes, []time.Time{t.Truncate(a.size)}, a.size, wm)
+}
+
+type sliding struct {
+	size  time.Duration
+	slide time.Duration
+}
+
+// assign returns no windows for values between windows when slide is
+// greater than size.
+func (a sliding) assign(panes []*pane, t, wm time.Time) ([]*pane, []*pane, bool) {
+	starts := []time.Time{}
+	for start := t.Truncate(a.slide); start.Add(a.size).After(t); start = start.Add(-a.slide) {
+		starts = append([]time.Time{start}, starts...)
+	}
+	return assignStarts(panes, starts, a.size, wm)
+}
+
+func assignStarts(panes []*pane, starts []time.Time, size time.Duration, wm time.Time) ([]*pane, []*pane, bool) {
+	target := []*pane{}
+	for _, start := range starts {
+		end := start.Add(size)
+		if !end.After(wm) {
+			continue
+		}
+		p := findPane(panes, start)
+		if p == nil {
+			p = &pane{Result: Result{Start: start, End: end}}
+			panes = append(panes, p)
+		}
+		target = append(target, p)
+	}
+	return target, panes, len(starts) > 0 && len(target) == 0
+}
+
+func findPane(panes []*pane, start time.Time) *pane {
+	for _, p := range panes {
+		if p.Start.Equal(start) {
+			return p
+		}
+	}
+	return nil
+}
+
+type session struct {
+	gap time.Duration
+}
+
+// assign creates a session for t and merges it with any overlapping session.
+func (a session) assign(panes []*pane, t, wm time.Time) ([]*pane, []*pane, bool) {
+	merged := &pane{Result: Result{Start: t, End: t.Add(a.gap)}}
+	all := []*pane{}
+	for _, p := range panes {
+		if !p.Start.Before(merged.End) || !merged.Start.Before(p.End) {
+			all = append(all, p)
+			continue
+		}
+		if p.Start.Before(merged.Start) {
+			merged.Start = p.Start
+		}
+		if p.End.After(merged.End) {
+			merged.End = p.End
+		}
+		if merged.seq == 0 || p.seq < merged.seq {
+			merged.seq = p.seq
+			merged.Key = p.Key
+		}
+		merged.Values = append(merged.Values, p.Values...)
+	}
+	if !merged.End.After(wm) {
+		return nil, panes, true
+	}
+	return []*pane{merged}, append(all, merged), false
+}
@@ -0,0 +1,272 @@
+// Package window provides procs that group streamed values in tumbling,
+// sliding or session windows.
+//
+// Window procs have two outputs, "windows" (0) where a Result is sent for
+// every closed window and "late" (1) where values that arrive after their
+// windows were closed are sent as is.
+//
+// Window state is kept per worker so window procs should run with a single
+// worker.
+package window
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/stdiopt/pipe"
+)
+
+// Output names of window procs
+const (
+	OutputWindows = "windows"
+	OutputLate    = "late"
+)
+
+const defaultTick = 100 * time.Millisecond
+
+// Result is sent on the windows output when a window closes.
+type Result struct {
+	Key    interface{}
+	Start  time.Time
+	End    time.Time
+	Values []interface{}
+}
+
+// KeyFunc returns the key that groups a value, keys must be comparable.
+type KeyFunc func(v interface{}) interface{}
+
+// TimeFunc extracts the event time of a value.
+type TimeFunc func(v interface{}) time.Time
+
+// Option configures a window proc.
+type Option func(w *windower)
+
+// WithKey sets the func used to key values, windows are computed separately
+// for each key, by default all values share the same key.
+func WithKey(fn KeyFunc) Option {
+	return func(w *windower) { w.key = fn }
+}
+
+// WithEventTime uses fn to extract the time of each value, windows are then
+// closed by a watermark that follows the maximum event time seen. By default
+// the processing time is used.
+func WithEventTime(fn TimeFunc) Option {
+	return func(w *windower) { w.eventTime = fn }
+}
+
+// WithAllowedLateness sets how far behind the watermark is, values older than
+// the watermark are considered late if their windows are already closed.
+func WithAllowedLateness(d time.Duration) Option {
+	return func(w *windower) { w.lateness = d }
+}
+
+// WithTick sets the interval in which processing time windows are checked
+// for closing, defaults to 100ms.
+func WithTick(d time.Duration) Option {
+	return func(w *windower) { w.tick = d }
+}
+
+// WithProcOptions passes options to the underlying proc, such as
+// pipe.WithSource or pipe.WithName.
+func WithProcOptions(opts ...pipe.ProcFunc) Option {
+	return func(w *windower) { w.procOpts = append(w.procOpts, opts...) }
+}
+
+// Tumbling returns a proc that groups values in fixed, non overlapping
+// windows of size, size should be positive.
+func Tumbling(size time.Duration, opts ...Option) *pipe.Proc {
+	if size <= 0 {
+		panic("window.Tumbling size should be positive")
+	}
+	return newProc(tumbling{size}, opts...)
+}
+
+// Sliding returns a proc that groups values in windows of size starting at
+// every slide, a value can belong to several windows. size and slide should
+// be positive, if slide is greater than size values between windows are
+// dropped.
+func Sliding(size, slide time.Duration, opts ...Option) *pipe.Proc {
+	if size <= 0 || slide <= 0 {
+		panic("window.Sliding size and slide should be positive")
+	}
+	return newProc(sliding{size, slide}, opts...)
+}
+
+// Session returns a proc that groups values in windows that close after no
+// values of the same key are received within gap, gap should be positive.
+func Session(gap time.Duration, opts ...Option) *pipe.Proc {
+	if gap <= 0 {
+		panic("window.Session gap should be positive")
+	}
+	return newProc(session{gap}, opts...)
+}
+
+func newProc(a assigner, opts ...Option) *pipe.Proc {
+	w := &windower{assigner: a, tick: defaultTick}
+	for _, fn := range opts {
+		fn(w)
+	}
+	return pipe.NewProc(append([]pipe.ProcFunc{
+		pipe.WithOutputs(OutputWindows, OutputLate),
+		pipe.WithFunc(w.run),
+	}, w.procOpts...)...)
+}
+
+type windower struct {
+	assigner  assigner
+	key       KeyFunc
+	eventTime TimeFunc
+	lateness  time.Duration
+	tick      time.Duration
+	procOpts  []pipe.ProcFunc
+}
+
+func (w *windower) run(c pipe.Consumer, windows, late pipe.Sender) error {
+	s := &state{
+		assigner: w.assigner,
+		panes:    map[interface{}][]*pane{},
+	}
+
+	var mu sync.Mutex
+	var tickErr error
+	ctx, cancel := context.WithCancel(c.Context())
+	var wg sync.WaitGroup
+	if w.eventTime == nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t := time.NewTicker(w.tick)
+			defer t.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case now := <-t.C:
+					mu.Lock()
+					err := s.advance(now.Add(-w.lateness), windows)
+					if err != nil && tickErr == nil {
+						tickErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	err := c.Consume(func(m pipe.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if tickErr != nil {
+			return tickErr
+		}
+
+		v := m.Value()
+		var key interface{}
+		if w.key != nil {
+			key = w.key(v)
+		}
+		t := time.Now()
+		if w.eventTime != nil {
+			t = w.eventTime(v)
+		}
+		if !s.add(key, t, v) {
+			return late.Send(v)
+		}
+		if w.eventTime == nil {
+			return nil
+		}
+		return s.advance(s.maxTime.Add(-w.lateness), windows)
+	})
+	cancel()
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	if tickErr != nil {
+		return tickErr
+	}
+	// input is closed so every remaining window is complete
+	return s.flush(windows)
+}
+
+type pane struct {
+	Result
+	seq int
+}
+
+type state struct {
+	assigner  assigner
+	panes     map[interface{}][]*pane
+	watermark time.Time
+	maxTime   time.Time
+	seq       int
+}
+
+// add assigns the value to its windows for key, it returns false if the
+// value is late, values that belong to no window are dropped.
+func (s *state) add(key interface{}, t time.Time, v interface{}) bool {
+	if t.After(s.maxTime) {
+		s.maxTime = t
+	}
+	target, all, late := s.assigner.assign(s.panes[key], t, s.watermark)
+	if late {
+		return false
+	}
+	for _, p := range target {
+		if p.seq == 0 {
+			s.seq++
+			p.seq = s.seq
+			p.Key = key
+		}
+		p.Values = append(p.Values, v)
+	}
+	s.panes[key] = all
+	return true
+}
+
+// advance moves the watermark and sends the windows that ended before it.
+func (s *state) advance(wm time.Time, out pipe.Sender) error {
+	if !wm.After(s.watermark) {
+		return nil
+	}
+	s.watermark = wm
+	return s.send(out, func(p *pane) bool { return !p.End.After(wm) })
+}
+
+func (s *state) flush(out pipe.Sender) error {
+	return s.send(out, func(*pane) bool { return true })
+}
+
+func (s *state) send(out pipe.Sender, closed func(p *pane) bool) error {
+	fired := []*pane{}
+	for k, panes := range s.panes {
+		open := panes[:0]
+		for _, p := range panes {
+			if closed(p) {
+				fired = append(fired, p)
+				continue
+			}
+			open = append(open, p)
+		}
+		if len(open) == 0 {
+			delete(s.panes, k)
+			continue
+		}
+		s.panes[k] = open
+	}
+	sort.Slice(fired, func(i, j int) bool {
+		a, b := fired[i], fired[j]
+		if !a.End.Equal(b.End) {
+			return a.End.Before(b.End)
+		}
+		return a.seq < b.seq
+	})
+	for _, p := range fired {
+		if err := out.Send(p.Result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
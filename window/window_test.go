@@ -0,0 +1,229 @@
+package window_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stdiopt/pipe"
+	"github.com/stdiopt/pipe/window"
+)
+
+type event struct {
+	key string
+	sec int
+}
+
+func (e event) String() string { return fmt.Sprintf("%s@%d", e.key, e.sec) }
+
+var epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func eventTime(v interface{}) time.Time {
+	return epoch.Add(time.Duration(v.(event).sec) * time.Second)
+}
+
+func eventKey(v interface{}) interface{} { return v.(event).key }
+
+func TestWindows(t *testing.T) {
+	tests := []struct {
+		name     string
+		window   func(opts ...window.Option) *pipe.Proc
+		opts     []window.Option
+		events   []event
+		wantRes  []string
+		wantLate []string
+	}{
+		{
+			name: "tumbling",
+			window: func(opts ...window.Option) *pipe.Proc {
+				return window.Tumbling(10*time.Second, opts...)
+			},
+			events: []event{{"a", 1}, {"a", 5}, {"a", 12}, {"a", 25}},
+			wantRes: []string{
+				"<nil> 0-10 [a@1 a@5]",
+				"<nil> 10-20 [a@12]",
+				"<nil> 20-30 [a@25]",
+			},
+		},
+		{
+			name: "tumbling keyed",
+			window: func(opts ...window.Option) *pipe.Proc {
+				return window.Tumbling(10*time.Second, opts...)
+			},
+			opts:   []window.Option{window.WithKey(eventKey)},
+			events: []event{{"a", 1}, {"b", 2}, {"a", 3}, {"b", 11}},
+			wantRes: []string{
+				"a 0-10 [a@1 a@3]",
+				"b 0-10 [b@2]",
+				"b 10-20 [b@11]",
+			},
+		},
+		{
+			name: "sliding",
+			window: func(opts ...window.Option) *pipe.Proc {
+				return window.Sliding(10*time.Second, 5*time.Second, opts...)
+			},
+			events: []event{{"a", 1}, {"a", 7}, {"a", 12}},
+			wantRes: []string{
+				"<nil> -5-5 [a@1]",
+				"<nil> 0-10 [a@1 a@7]",
+				"<nil> 5-15 [a@7 a@12]",
+				"<nil> 10-20 [a@12]",
+			},
+		},
+		{
+			name: "sliding with gaps",
+			window: func(opts ...window.Option) *pipe.Proc {
+				return window.Sliding(5*time.Second, 10*time.Second, opts...)
+			},
+			events: []event{{"a", 1}, {"a", 7}, {"a", 12}},
+			wantRes: []string{
+				"<nil> 0-5 [a@1]",
+				"<nil> 10-15 [a@12]",
+			},
+		},
+		{
+			name: "session",
+			window: func(opts ...window.Option) *pipe.Proc {
+				return window.Session(5*time.Second, opts...)
+			},
+			opts:   []window.Option{window.WithKey(eventKey)},
+			events: []event{{"a", 1}, {"b", 2}, {"a", 4}, {"a", 20}, {"b", 30}},
+			wantRes: []string{
+				"b 2-7 [b@2]",
+				"a 1-9 [a@1 a@4]",
+				"a 20-25 [a@20]",
+				"b 30-35 [b@30]",
+			},
+		},
+		{
+			name: "late",
+			window: func(opts ...window.Option) *pipe.Proc {
+				return window.Tumbling(10*time.Second, opts...)
+			},
+			opts:   []window.Option{window.WithAllowedLateness(2 * time.Second)},
+			events: []event{{"a", 1}, {"a", 11}, {"a", 9}, {"a", 13}, {"a", 8}},
+			wantRes: []string{
+				"<nil> 0-10 [a@1 a@9]",
+				"<nil> 10-20 [a@11 a@13]",
+			},
+			wantLate: []string{"a@8"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origin := pipe.NewProc(
+				pipe.WithFunc(func(s pipe.Sender) error {
+					for _, e := range tt.events {
+						if err := s.Send(e); err != nil {
+							return err
+						}
+					}
+					return nil
+				}),
+			)
+			opts := append([]window.Option{
+				window.WithEventTime(eventTime),
+				window.WithProcOptions(pipe.WithSource(0, origin)),
+			}, tt.opts...)
+			w := tt.window(opts...)
+
+			var res, late []string
+			pipe.NewProc(
+				pipe.WithNamedSource(window.OutputWindows, w),
+				pipe.WithFunc(func(c pipe.Consumer) error {
+					return c.Consume(func(r window.Result) error {
+						res = append(res, fmt.Sprintf("%v %d-%d %v",
+							r.Key,
+							r.Start.Sub(epoch)/time.Second,
+							r.End.Sub(epoch)/time.Second,
+							r.Values,
+						))
+						return nil
+					})
+				}),
+			)
+			pipe.NewProc(
+				pipe.WithNamedSource(window.OutputLate, w),
+				pipe.WithFunc(func(c pipe.Consumer) error {
+					return c.Consume(func(e event) error {
+						late = append(late, e.String())
+						return nil
+					})
+				}),
+			)
+
+			if err := origin.Run(); err != nil {
+				t.Fatal(err)
+			}
+			if want := tt.wantRes; !reflect.DeepEqual(res, want) {
+				t.Errorf("\nwant: %v\n got: %v\n", want, res)
+			}
+			if want := tt.wantLate; !reflect.DeepEqual(late, want) {
+				t.Errorf("\nwant: %v\n got: %v\n", want, late)
+			}
+		})
+	}
+}
+
+func TestWindowParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		window func()
+	}{
+		{"tumbling size", func() { window.Tumbling(0) }},
+		{"sliding size", func() { window.Sliding(-time.Second, time.Second) }},
+		{"sliding slide", func() { window.Sliding(time.Second, 0) }},
+		{"session gap", func() { window.Session(0) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected a panic")
+				}
+			}()
+			tt.window()
+		})
+	}
+}
+
+func TestProcessingTime(t *testing.T) {
+	origin := pipe.NewProc(
+		pipe.WithFunc(func(s pipe.Sender) error {
+			for i := 0; i < 3; i++ {
+				if err := s.Send(i); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	)
+	w := window.Tumbling(time.Hour,
+		window.WithTick(time.Millisecond),
+		window.WithProcOptions(pipe.WithSource(0, origin)),
+	)
+	var res []window.Result
+	pipe.NewProc(
+		pipe.WithSource(0, w),
+		pipe.WithFunc(func(c pipe.Consumer) error {
+			return c.Consume(func(r window.Result) error {
+				res = append(res, r)
+				return nil
+			})
+		}),
+	)
+	if err := origin.Run(); err != nil {
+		t.Fatal(err)
+	}
+	// all values are flushed when the input closes
+	n := 0
+	for _, r := range res {
+		n += len(r.Values)
+	}
+	if want := 3; n != want {
+		t.Errorf("\nwant: %v\n got: %v\n", want, n)
+	}
+}